@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	adaptiveLookahead = flag.Int("adaptive-lookahead", 0, "Days to look ahead for a vaccination type without free slots in the regular window for several polls (0 disables)")
+	adaptiveAfter     = flag.Int("adaptive-after", 3, "Consecutive polls without free slots in the regular window before the adaptive lookahead is used")
+)
+
+// AdaptiveLookahead widens the lookahead of practices and motives which had no free slots in the
+// regular window for several polls, so the true next slot is found without querying every
+// series far ahead. It returns to the regular window once the next slot is within it again.
+// The widened queries are still a single request, so the request budget is unaffected.
+type AdaptiveLookahead struct {
+	mu sync.Mutex
+	// consecutive polls without a slot in the regular window per practice, motive and insurance sector
+	misses map[practiceKey]int
+
+	desc *prometheus.Desc
+}
+
+var adaptive = &AdaptiveLookahead{misses: map[practiceKey]int{}}
+
+type lookaheadKey struct{}
+
+// Lookahead returns the number of days to query for a poll, widened by the adaptive
+// lookahead of ctx or the burst mode.
+func Lookahead(ctx context.Context, days int) int {
+	days = burst.CurrentLookahead(days)
+	if d, ok := ctx.Value(lookaheadKey{}).(int); ok && d > days {
+		return d
+	}
+	return days
+}
+
+// Context returns the context for querying a practice and motive, widened if they had no
+// slots in the regular window for --adaptive-after polls.
+func (a *AdaptiveLookahead) Context(ctx context.Context, practice, motive int) context.Context {
+	if *adaptiveLookahead <= 0 {
+		return ctx
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.misses[practiceKey{practice, motive, InsuranceSector(ctx)}] < *adaptiveAfter {
+		return ctx
+	}
+	return context.WithValue(ctx, lookaheadKey{}, *adaptiveLookahead)
+}
+
+// Observe records whether the practice and motive had a slot within the regular window of days.
+func (a *AdaptiveLookahead) Observe(ctx context.Context, practice, motive int, near bool) {
+	if *adaptiveLookahead <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := practiceKey{practice, motive, InsuranceSector(ctx)}
+	if near {
+		delete(a.misses, key)
+		return
+	}
+	a.misses[key]++
+}
+
+// Forget drops the misses of a practice.
+func (a *AdaptiveLookahead) Forget(practice int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.misses {
+		if key.practice == practice {
+			delete(a.misses, key)
+		}
+	}
+}
+
+func (a *AdaptiveLookahead) Describe(ch chan<- *prometheus.Desc) {
+	if a.desc == nil {
+		a.desc = prometheus.NewDesc("impfe_adaptive_lookahead_series",
+			"Kombinationen aus Praxis und Impfung, die mit erweitertem Vorausschauzeitraum abgefragt werden",
+			nil, nil,
+		)
+	}
+	ch <- a.desc
+}
+
+func (a *AdaptiveLookahead) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	extended := 0
+	for _, n := range a.misses {
+		if n >= *adaptiveAfter {
+			extended++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, float64(extended))
+}
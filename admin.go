@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminTokenEnv holds the bearer token of the admin API, it is not a flag to keep it out of
+// the process list and impfe config print.
+const adminTokenEnv = "IMPFE_ADMIN_TOKEN"
+
+// minAdminTokenLength rejects tokens which are easy to guess.
+const minAdminTokenLength = 16
+
+// adminToken is the bearer token of the admin API, empty if the admin API is disabled.
+var adminToken string
+
+// SetupAdmin reads the token of the admin API.
+func SetupAdmin() error {
+	adminToken = os.Getenv(adminTokenEnv)
+	if adminToken != "" && len(adminToken) < minAdminTokenLength {
+		return fmt.Errorf("%s must be at least %d characters long", adminTokenEnv, minAdminTokenLength)
+	}
+	return nil
+}
+
+// AdminHandler guards an endpoint of the admin API by the bearer token from IMPFE_ADMIN_TOKEN.
+// Without a token the admin API is disabled and all requests are refused.
+func AdminHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "admin API disabled, set "+adminTokenEnv, http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="impfe admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
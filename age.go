@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ages = flag.String("ages", "", "Comma separated ages of the people to monitor for; motives none of them is eligible for are skipped")
+
+// AgeGroup is the age range a motive is restricted to, Max is -1 if unbounded.
+type AgeGroup struct {
+	Min, Max int
+}
+
+var (
+	ageRangeRe = regexp.MustCompile(`(\d+)\s*(?:-|–|bis)\s*(\d+)\s*J`)
+	ageMinRe   = regexp.MustCompile(`(?i)(?:ab|über|ueber)\s*(\d+)|(\d+)\s*\+`)
+	ageMaxRe   = regexp.MustCompile(`(?i)unter\s*(\d+)`)
+)
+
+// ParseAgeGroup detects age constraints like "ab 60", "5-11 Jahre" or "unter 30" in a motive name.
+func ParseAgeGroup(motive string) AgeGroup {
+	if m := ageRangeRe.FindStringSubmatch(motive); m != nil {
+		min, _ := strconv.Atoi(m[1])
+		max, _ := strconv.Atoi(m[2])
+		return AgeGroup{min, max}
+	}
+	if m := ageMinRe.FindStringSubmatch(motive); m != nil {
+		min, _ := strconv.Atoi(m[1] + m[2])
+		return AgeGroup{min, -1}
+	}
+	if m := ageMaxRe.FindStringSubmatch(motive); m != nil {
+		max, _ := strconv.Atoi(m[1])
+		return AgeGroup{0, max - 1}
+	}
+	return AgeGroup{0, -1}
+}
+
+// Contains reports whether age is within the group.
+func (g AgeGroup) Contains(age int) bool {
+	return age >= g.Min && (g.Max < 0 || age <= g.Max)
+}
+
+// String returns the label value of the group, e.g. "60+", "5-11" or "all".
+func (g AgeGroup) String() string {
+	switch {
+	case g.Min == 0 && g.Max < 0:
+		return "all"
+	case g.Max < 0:
+		return fmt.Sprintf("%d+", g.Min)
+	default:
+		return fmt.Sprintf("%d-%d", g.Min, g.Max)
+	}
+}
+
+// ParseAges parses the configured ages, nil means no age filter.
+func ParseAges() ([]int, error) {
+	var result []int
+	for _, a := range strings.Split(*ages, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		age, err := strconv.Atoi(a)
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("Invalid age %q", a)
+		}
+		result = append(result, age)
+	}
+	return result, nil
+}
+
+// Eligible reports whether any of the ages is eligible for the motive. Without ages everybody is.
+func Eligible(motive string, ages []int) bool {
+	if len(ages) == 0 {
+		return true
+	}
+	group := ParseAgeGroup(motive)
+	for _, age := range ages {
+		if group.Contains(age) {
+			return true
+		}
+	}
+	return false
+}
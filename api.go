@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AvailabilitiesResponse is the body of /api/v1/availabilities.
+type AvailabilitiesResponse struct {
+	// Time of the poll the data stems from.
+	Time    time.Time   `json:"time"`
+	Centers []APICenter `json:"centers"`
+}
+
+// APICenter is a center with the availabilities of its vaccination types.
+type APICenter struct {
+	Name        string `json:"name"`
+	BookingPage string `json:"booking_page"`
+	// PracticeID identifies the center, unlike the name it does not change.
+	PracticeID int `json:"practice_id"`
+	// Aliases are the previous names of the center, oldest first.
+	Aliases []string `json:"aliases,omitempty"`
+	Zipcode string   `json:"zipcode,omitempty"`
+	City    string   `json:"city,omitempty"`
+	Region  string   `json:"region,omitempty"`
+	// Open is unset if the opening hours are unknown.
+	Open           *bool             `json:"open,omitempty"`
+	Availabilities []APIAvailability `json:"availabilities"`
+}
+
+// APIAvailability is the availability of one vaccination type.
+type APIAvailability struct {
+	MotiveID int    `json:"motive_id"`
+	Motive   string `json:"motive"`
+	Vaccine  string `json:"vaccine"`
+	Dose     string `json:"dose"`
+	Channel  string `json:"channel"`
+	AgeGroup string `json:"age_group"`
+	// Insurance is the insurance sector the availability was queried for.
+	Insurance string `json:"insurance"`
+	// NextSlot is the date of the next free slot, empty if there is none.
+	NextSlot           string     `json:"next_slot,omitempty"`
+	NextSlotTime       *time.Time `json:"next_slot_time,omitempty"`
+	Slots              int        `json:"slots"`
+	FutureVaccinations int        `json:"future_vaccinations"`
+	Link               string     `json:"link"`
+}
+
+// APIHandler serves the latest snapshot as JSON. The query parameters vaccine
+// and booking_page restrict the response.
+type APIHandler struct {
+	snapshot func() *Snapshot
+}
+
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := h.snapshot()
+	if snap == nil {
+		http.Error(w, "no successful poll yet", http.StatusServiceUnavailable)
+		return
+	}
+	vaccine, bookingPage := r.URL.Query().Get("vaccine"), r.URL.Query().Get("booking_page")
+	resp := NewAvailabilitiesResponse(snap, func(o Observation) bool {
+		return (bookingPage == "" || o.Center.BookingPage == bookingPage) && (vaccine == "" || VaccineLabel(o.Motive) == vaccine)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// NewAvailabilitiesResponse returns the observations of snap selected by keep grouped by center.
+func NewAvailabilitiesResponse(snap *Snapshot, keep func(Observation) bool) AvailabilitiesResponse {
+	resp := AvailabilitiesResponse{Time: snap.Time, Centers: []APICenter{}}
+	index := map[centerKey]int{}
+	for _, o := range snap.Observations {
+		if !keep(o) {
+			continue
+		}
+		a := APIAvailability{
+			MotiveID:           o.MotiveID,
+			Motive:             o.Motive,
+			Vaccine:            VaccineLabel(o.Motive),
+			Dose:               DoseLabel(o.Motive),
+			Channel:            o.Center.Channel(o.MotiveID),
+			AgeGroup:           ParseAgeGroup(o.Motive).String(),
+			Insurance:          o.Insurance,
+			Slots:              o.Slots,
+			FutureVaccinations: o.FutureVaccinations,
+			Link:               BookingLink(o.Center.BookingPage),
+		}
+		if !o.NextSlot.IsZero() {
+			a.NextSlot = o.NextSlot.Format("2006-01-02")
+			t := o.NextSlotTime
+			a.NextSlotTime = &t
+		}
+		i, ok := index[keyOfCenter(o.Center)]
+		if !ok {
+			c := APICenter{Name: o.Center.Name, BookingPage: o.Center.BookingPage, PracticeID: o.Center.ID,
+				Zipcode: o.Center.Zipcode, City: o.Center.City, Aliases: lifecycle.Aliases(keyOfCenter(o.Center))}
+			if open, known := IsOpen(o.Center.OpeningHours, snap.Time); known {
+				c.Open = &open
+			}
+			if len(config.Regions) > 0 {
+				c.Region = Region(o.Center)
+			}
+			i = len(resp.Centers)
+			index[keyOfCenter(o.Center)] = i
+			resp.Centers = append(resp.Centers, c)
+		}
+		resp.Centers[i].Availabilities = append(resp.Centers[i].Availabilities, a)
+	}
+	sort.Slice(resp.Centers, func(i, j int) bool { return resp.Centers[i].Name < resp.Centers[j].Name })
+	for _, c := range resp.Centers {
+		sort.Slice(c.Availabilities, func(i, j int) bool { return c.Availabilities[i].MotiveID < c.Availabilities[j].MotiveID })
+	}
+	return resp
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// archiveEntry returns the name of a state file in a backup archive. It is derived from the
+// flag instead of the path, so the archive can be restored on a host using other paths.
+func archiveEntry(f stateFile) string {
+	return strings.TrimSuffix(f.Flag, "-file") + ".json"
+}
+
+// WriteArchive writes the existing state files as gzipped tar to w and returns their paths.
+func WriteArchive(w io.Writer) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	var written []string
+	for _, f := range configuredStateFiles() {
+		data, err := os.ReadFile(f.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		header := &tar.Header{Name: archiveEntry(f), Mode: 0644, Size: int64(len(data)), ModTime: clock.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+		written = append(written, f.Path)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// RunBackup writes the state files to the archive out, e.g. to move an instance to another host.
+func RunBackup(w io.Writer, out string) error {
+	if len(configuredStateFiles()) == 0 {
+		return fmt.Errorf("No state file configured, set --crawl-state-file, --center-state-file or --mute-state-file")
+	}
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	files, err := WriteArchive(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Writing backup %s failed: %s", out, err)
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Fprintln(w, "Backed up", file)
+	}
+	fmt.Fprintf(w, "Wrote %d state files to %s\n", len(files), out)
+	return nil
+}
+
+// RunRestore writes the state files of the archive in to the paths configured by their flags.
+// Nothing is written unless the whole archive is valid, existing state files are only
+// replaced with force.
+func RunRestore(w io.Writer, in string, force bool) error {
+	configured := map[string]stateFile{}
+	for _, f := range configuredStateFiles() {
+		configured[archiveEntry(f)] = f
+	}
+	r, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("Reading backup %s failed: %s", in, err)
+	}
+	type entry struct {
+		file stateFile
+		data []byte
+	}
+	var entries []entry
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Reading backup %s failed: %s", in, err)
+		}
+		f, ok := configured[header.Name]
+		if !ok {
+			fmt.Fprintf(w, "Skipping %s, set --%s to restore it\n", header.Name, strings.TrimSuffix(header.Name, ".json")+"-file")
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("Reading backup %s failed: %s", in, err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("Backup %s contains an invalid %s", in, header.Name)
+		}
+		entries = append(entries, entry{f, data})
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("Backup %s contains no configured state file", in)
+	}
+	if !force {
+		for _, e := range entries {
+			if _, err := os.Stat(e.file.Path); err == nil {
+				return fmt.Errorf("State file %s exists, use --force to replace it", e.file.Path)
+			}
+		}
+	}
+	for _, e := range entries {
+		tmp := e.file.Path + ".tmp"
+		if err := os.WriteFile(tmp, e.data, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, e.file.Path); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Restored %s\n", e.file.Path)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestoreArchive(t *testing.T) {
+	defer func(crawl, center, mute string) {
+		*crawlStateFile, *centerStateFile, *muteStateFile = crawl, center, mute
+	}(*crawlStateFile, *centerStateFile, *muteStateFile)
+
+	old, migrated := t.TempDir(), t.TempDir()
+	*crawlStateFile = filepath.Join(old, "crawl.json")
+	*centerStateFile = filepath.Join(old, "centers.json")
+	*muteStateFile = filepath.Join(old, "mutes.json")
+	if err := os.WriteFile(*centerStateFile, []byte(`[{"booking_page":"ciz-berlin-berlin","practice_id":1,"name":"Arena"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(*muteStateFile, []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(old, "backup.tar.gz")
+	if err := RunBackup(io.Discard, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new host uses other paths and does not persist mutes
+	*crawlStateFile = filepath.Join(migrated, "crawl-state.json")
+	*centerStateFile = filepath.Join(migrated, "center-state.json")
+	*muteStateFile = ""
+	var out strings.Builder
+	if err := RunRestore(&out, archive, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(*centerStateFile)
+	if err != nil || !strings.Contains(string(data), "Arena") {
+		t.Errorf("restored center state = %q, %v", data, err)
+	}
+	if _, err := os.Stat(*crawlStateFile); !os.IsNotExist(err) {
+		t.Errorf("crawl state was restored although it was missing from the backup: %v", err)
+	}
+	if !strings.Contains(out.String(), "--mute-state-file") {
+		t.Errorf("restore did not report the skipped mutes:\n%s", out.String())
+	}
+
+	if err := RunRestore(io.Discard, archive, false); err == nil {
+		t.Error("restore replaced an existing state file without --force")
+	}
+	if err := RunRestore(io.Discard, archive, true); err != nil {
+		t.Errorf("restore with --force failed: %s", err)
+	}
+}
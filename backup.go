@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/databus23/impfe/pkg/s3"
+)
+
+var (
+	backupBucket    = flag.String("backup-bucket", "", "S3 compatible bucket to back up the state files to (empty disables backups)")
+	backupEndpoint  = flag.String("backup-endpoint", "https://s3.amazonaws.com", "Endpoint of the object storage, e.g. https://storage.googleapis.com for GCS")
+	backupRegion    = flag.String("backup-region", "us-east-1", "Region of the bucket, auto for GCS")
+	backupPrefix    = flag.String("backup-prefix", "impfe/", "Prefix of the backup objects")
+	backupInterval  = flag.Duration("backup-interval", time.Hour, "Interval between two backups")
+	backupRetention = flag.Int("backup-retention", 24, "Number of backups kept per state file")
+)
+
+// backupStore is the bucket backups are written to, nil if backups are disabled.
+var backupStore *s3.Client
+
+// SetupBackup prepares the bucket client. The credentials are read from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, for GCS these are HMAC keys.
+func SetupBackup() error {
+	if *backupBucket == "" {
+		return nil
+	}
+	if *backupRetention < 1 {
+		return fmt.Errorf("Backup retention must be at least 1, got %d", *backupRetention)
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("Backups need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	backupStore = &s3.Client{
+		Endpoint:   *backupEndpoint,
+		Region:     *backupRegion,
+		Bucket:     *backupBucket,
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+		HTTPClient: backupHTTPClient,
+	}
+	return nil
+}
+
+// backupHTTPClient talks to the object storage, it must not share the rate limits of Doctolib.
+var backupHTTPClient = &http.Client{Timeout: time.Minute}
+
+// stateFile is a state file configured by the flag Flag.
+type stateFile struct {
+	Flag string
+	Path string
+}
+
+// configuredStateFiles returns the state files worth backing up, with their flags.
+func configuredStateFiles() []stateFile {
+	var files []stateFile
+	for _, f := range []stateFile{
+		{"crawl-state-file", *crawlStateFile},
+		{"center-state-file", *centerStateFile},
+		{"mute-state-file", *muteStateFile},
+	} {
+		if f.Path != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// stateFiles returns the paths of the state files worth backing up.
+func stateFiles() []string {
+	var files []string
+	for _, f := range configuredStateFiles() {
+		files = append(files, f.Path)
+	}
+	return files
+}
+
+// backupKeyPrefix returns the prefix of the backups of a state file.
+func backupKeyPrefix(file string) string {
+	return path.Join(*backupPrefix, filepath.Base(file)) + "/"
+}
+
+// RestoreState downloads the latest backup of every state file missing locally,
+// so state survives the replacement of an ephemeral host.
+func RestoreState(ctx context.Context) error {
+	if backupStore == nil {
+		return nil
+	}
+	for _, file := range stateFiles() {
+		if _, err := os.Stat(file); err == nil {
+			continue
+		}
+		objects, err := backupStore.List(ctx, backupKeyPrefix(file))
+		if err != nil {
+			return fmt.Errorf("Failed to list backups of %s: %s", file, err)
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		latest := objects[len(objects)-1]
+		data, err := backupStore.Get(ctx, latest.Key)
+		if err != nil {
+			return fmt.Errorf("Failed to download backup %s: %s", latest.Key, err)
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+		log.Printf("Restored %s from backup %s", file, latest.Key)
+	}
+	return nil
+}
+
+// Backup uploads every existing state file and removes the backups beyond the retention.
+func Backup(ctx context.Context) {
+	for _, file := range stateFiles() {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Backup of %s failed: %s", file, err)
+			continue
+		}
+		prefix := backupKeyPrefix(file)
+		// the timestamp keeps the keys in chronological order
+		key := prefix + clock.Now().UTC().Format("20060102T150405Z") + filepath.Ext(file)
+		if err := backupStore.Put(ctx, key, data); err != nil {
+			log.Printf("Backup of %s failed: %s", file, err)
+			continue
+		}
+		objects, err := backupStore.List(ctx, prefix)
+		if err != nil {
+			log.Printf("Failed to list backups of %s: %s", file, err)
+			continue
+		}
+		for i := 0; i < len(objects)-*backupRetention; i++ {
+			if !strings.HasPrefix(objects[i].Key, prefix) {
+				continue
+			}
+			if err := backupStore.Delete(ctx, objects[i].Key); err != nil {
+				log.Printf("Failed to delete expired backup %s: %s", objects[i].Key, err)
+			}
+		}
+	}
+}
+
+// RunBackups backs up the state every backup interval until ctx is done.
+func RunBackups(ctx context.Context) {
+	if backupStore == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(*backupInterval):
+		}
+		Backup(ctx)
+	}
+}
+
+// FinalBackup backs up the state once more on shutdown.
+func FinalBackup() {
+	if backupStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	Backup(ctx)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// defaultBroadcastTitle is the title of broadcasts sent without one.
+const defaultBroadcastTitle = "Hinweis des Betreibers"
+
+// Broadcaster is implemented by notifiers which can deliver operator messages besides notifications.
+type Broadcaster interface {
+	Broadcast(ctx context.Context, title, text string) error
+}
+
+// BroadcastResult reports the delivery of a broadcast.
+type BroadcastResult struct {
+	Delivered int `json:"delivered"`
+	// Failed lists the notifiers the broadcast could not be delivered to with the error.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Broadcast sends an operator message to all targets regardless of their selection,
+// retrying transient failures like notifications.
+func Broadcast(ctx context.Context, targets []Notifier, title, text string) BroadcastResult {
+	if title == "" {
+		title = defaultBroadcastTitle
+	}
+	var result BroadcastResult
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, n := range targets {
+		b, ok := n.(Broadcaster)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(notifier Notifier, b Broadcaster) {
+			defer wg.Done()
+			policy := retryPolicies[strings.SplitN(notifier.Name(), "/", 2)[0]]
+			err := Retry(ctx, policy, func() error {
+				return b.Broadcast(ctx, title, text)
+			})
+			notifyStats.Record(notifier.Name(), err)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Broadcasting to %s failed: %s", notifier.Name(), err)
+				result.Failed = append(result.Failed, fmt.Sprintf("%s: %s", notifier.Name(), err))
+				return
+			}
+			result.Delivered++
+		}(n, b)
+	}
+	wg.Wait()
+	return result
+}
+
+// RunBroadcast sends an operator message to the configured notifiers and fails unless it reached all of them.
+func RunBroadcast(ctx context.Context, w io.Writer, title, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("Broadcast message must not be empty")
+	}
+	result := Broadcast(ctx, notifiers, title, text)
+	fmt.Fprintf(w, "Delivered to %d notifiers\n", result.Delivered)
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("Broadcast failed for %s", strings.Join(result.Failed, ", "))
+	}
+	if result.Delivered == 0 {
+		return fmt.Errorf("No notifier configured")
+	}
+	return nil
+}
+
+// BroadcastHandler sends operator messages with POST ?text=<message>&title=<title>,
+// it must be guarded by AdminHandler.
+type BroadcastHandler struct{}
+
+func (BroadcastHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	text := r.FormValue("text")
+	if strings.TrimSpace(text) == "" {
+		http.Error(w, "missing text", http.StatusBadRequest)
+		return
+	}
+	result := Broadcast(r.Context(), notifiers, r.FormValue("title"), text)
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Failed) > 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+//go:embed browser_profiles.json
+var builtinBrowserProfiles []byte
+
+// BrowserProfile describes the headers (in the order a browser sends them) and
+// the TLS fingerprint used to emulate a browser for upstream requests.
+type BrowserProfile struct {
+	TLSFingerprint string      `json:"tls_fingerprint"`
+	Headers        [][2]string `json:"headers"`
+}
+
+// LoadBrowserProfiles returns the built-in browser profiles, merged with the ones from file if given.
+func LoadBrowserProfiles(file string) (map[string]BrowserProfile, error) {
+	profiles := map[string]BrowserProfile{}
+	if err := json.Unmarshal(builtinBrowserProfiles, &profiles); err != nil {
+		return nil, fmt.Errorf("Failed to parse built-in browser profiles: %s", err)
+	}
+	if file == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Reading browser profiles failed: %s", err)
+	}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("Failed to parse browser profiles %s: %s", file, err)
+	}
+	return profiles, nil
+}
+
+// headerTransport sets the headers of a browser profile on every request.
+// net/http does not preserve header order on the wire, so the order is only a hint.
+type headerTransport struct {
+	headers [][2]string
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, h := range t.headers {
+		req.Header.Set(h[0], h[1])
+	}
+	return t.next.RoundTrip(req)
+}
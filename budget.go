@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// minBudgetRequests is the number of requests within the window before the error budget is evaluated.
+const minBudgetRequests = 10
+
+// ErrorBudget pauses polling when too many upstream requests were blocked within a window.
+type ErrorBudget struct {
+	MaxFraction float64
+	Window      time.Duration
+	Cooldown    time.Duration
+	// Notify is called in the background when polling is paused and when it resumes, if set.
+	Notify func(paused bool, until time.Time)
+
+	mu          sync.Mutex
+	results     []budgetResult
+	pausedUntil time.Time
+	// paused is set from a pause until its end was noticed
+	paused bool
+}
+
+type budgetResult struct {
+	at      time.Time
+	blocked bool
+}
+
+// Record adds the outcome of an upstream request and starts a pause if the budget is exceeded.
+func (b *ErrorBudget) Record(blocked bool) {
+	if b.MaxFraction <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := clock.Now()
+	b.results = append(b.results, budgetResult{now, blocked})
+	i := 0
+	for i < len(b.results) && now.Sub(b.results[i].at) > b.Window {
+		i++
+	}
+	b.results = b.results[i:]
+
+	if len(b.results) < minBudgetRequests || now.Before(b.pausedUntil) {
+		return
+	}
+	var numBlocked int
+	for _, r := range b.results {
+		if r.blocked {
+			numBlocked++
+		}
+	}
+	if fraction := float64(numBlocked) / float64(len(b.results)); fraction > b.MaxFraction {
+		b.pausedUntil = now.Add(b.Cooldown)
+		log.Printf("%d of the last %d upstream requests were blocked, pausing polling until %s", numBlocked, len(b.results), b.pausedUntil.Format(time.RFC3339))
+		b.results = nil
+		b.paused = true
+		if b.Notify != nil {
+			go b.Notify(true, b.pausedUntil)
+		}
+	}
+}
+
+// Paused reports whether polling is currently paused. The first call after a pause ended reports its end.
+func (b *ErrorBudget) Paused() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paused := clock.Now().Before(b.pausedUntil)
+	if !paused && b.paused {
+		b.paused = false
+		log.Println("Resuming polling")
+		if b.Notify != nil {
+			go b.Notify(false, b.pausedUntil)
+		}
+	}
+	return paused
+}
+
+// pauseBroadcastTimeout bounds the delivery of a pause notice including retries.
+const pauseBroadcastTimeout = 5 * time.Minute
+
+// NotifyPause tells the subscribers of all notifiers that polling is paused or resumes,
+// since no notifications are sent while it is paused.
+func NotifyPause(paused bool, until time.Time) {
+	if len(notifiers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pauseBroadcastTimeout)
+	defer cancel()
+	if paused {
+		Broadcast(ctx, notifiers, "Abfragen pausiert",
+			fmt.Sprintf("Doctolib blockiert zu viele Anfragen, die Abfragen pausieren bis %s %s. Bis dahin gibt es keine Benachrichtigungen.",
+				FormatDate(until), until.In(location).Format("15:04")))
+		return
+	}
+	Broadcast(ctx, notifiers, "Abfragen fortgesetzt", "Die Abfragen laufen wieder, Benachrichtigungen ueber freie Termine folgen wie gewohnt.")
+}
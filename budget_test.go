@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorBudgetNotifiesPauseAndResume(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	type notice struct {
+		paused bool
+		until  time.Time
+	}
+	notices := make(chan notice, 4)
+	b := &ErrorBudget{MaxFraction: 0.5, Window: 10 * time.Minute, Cooldown: 30 * time.Minute,
+		Notify: func(paused bool, until time.Time) { notices <- notice{paused, until} }}
+	next := func() notice {
+		select {
+		case n := <-notices:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("No notice")
+		}
+		return notice{}
+	}
+
+	for i := 0; i < minBudgetRequests; i++ {
+		b.Record(i%4 != 0)
+	}
+	if !b.Paused() {
+		t.Fatal("Not paused after most requests were blocked")
+	}
+	want := c.Now().Add(30 * time.Minute)
+	if n := next(); !n.paused || !n.until.Equal(want) {
+		t.Errorf("pause notice = %+v, want paused until %s", n, want)
+	}
+
+	c.Advance(29 * time.Minute)
+	if !b.Paused() {
+		t.Error("Resumed before the cooldown passed")
+	}
+	c.Advance(time.Minute)
+	if b.Paused() {
+		t.Fatal("Still paused after the cooldown")
+	}
+	if n := next(); n.paused {
+		t.Errorf("resume notice = %+v, want resumed", n)
+	}
+	b.Paused()
+	select {
+	case n := <-notices:
+		t.Errorf("Unexpected notice %+v after resuming", n)
+	default:
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var burst = &BurstMode{}
+
+func init() {
+	flag.DurationVar(&burst.Interval, "burst-interval", 10*time.Second, "Poll interval while burst mode is active")
+	flag.IntVar(&burst.Lookahead, "burst-lookahead", 14, "Number of days to look ahead for free slots while burst mode is active")
+	flag.StringVar(&burst.ScheduleSpec, "burst-schedule", "", "Comma separated windows with burst mode, e.g. \"Mon-Fri 08:00-08:30,Sat 10:00-10:15\" or \"07:55-08:10\" for every day")
+}
+
+// BurstMode temporarily polls more often and further ahead, either while activated
+// via the admin API or within the configured schedule.
+type BurstMode struct {
+	Interval     time.Duration
+	Lookahead    int
+	ScheduleSpec string
+
+	mu       sync.Mutex
+	schedule []burstWindow
+	until    time.Time
+	// changed wakes up the poller when burst mode was activated
+	changed chan struct{}
+}
+
+// burstWindow is a daily time window on the given weekdays, minutes since midnight.
+type burstWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+var weekdays = map[string]time.Weekday{"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday, "Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday}
+
+// ParseBurstSchedule parses the windows of the burst schedule.
+func ParseBurstSchedule(spec string) ([]burstWindow, error) {
+	var windows []burstWindow
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var w burstWindow
+		days, hours := "", entry
+		if i := strings.Index(entry, " "); i >= 0 {
+			days, hours = entry[:i], strings.TrimSpace(entry[i+1:])
+		}
+		if days == "" {
+			for i := range w.days {
+				w.days[i] = true
+			}
+		} else {
+			parts := strings.SplitN(days, "-", 2)
+			from, ok := weekdays[parts[0]]
+			if !ok {
+				return nil, fmt.Errorf("Invalid weekday %q in burst schedule", parts[0])
+			}
+			to := from
+			if len(parts) == 2 {
+				if to, ok = weekdays[parts[1]]; !ok {
+					return nil, fmt.Errorf("Invalid weekday %q in burst schedule", parts[1])
+				}
+			}
+			for d := from; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == to {
+					break
+				}
+			}
+		}
+		parts := strings.SplitN(hours, "-", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid time window %q in burst schedule", hours)
+		}
+		for i, p := range parts {
+			t, err := time.Parse("15:04", p)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid time %q in burst schedule", p)
+			}
+			if i == 0 {
+				w.start = t.Hour()*60 + t.Minute()
+			} else {
+				w.end = t.Hour()*60 + t.Minute()
+			}
+		}
+		if w.end <= w.start {
+			return nil, fmt.Errorf("Time window %q in burst schedule ends before it starts", hours)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// Setup validates the settings and parses the schedule.
+func (b *BurstMode) Setup() error {
+	if b.Interval <= 0 {
+		return fmt.Errorf("Burst interval must be positive, got %s", b.Interval)
+	}
+	if b.Lookahead < 1 {
+		return fmt.Errorf("Burst lookahead must be at least 1, got %d", b.Lookahead)
+	}
+	schedule, err := ParseBurstSchedule(b.ScheduleSpec)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.schedule = schedule
+	return nil
+}
+
+// Activate enables burst mode for d, a non-positive d ends a manual burst.
+func (b *BurstMode) Activate(d time.Duration) {
+	b.mu.Lock()
+	if d > 0 {
+		b.until = clock.Now().Add(d)
+		log.Printf("Burst mode active until %s, polling every %s %d days ahead", b.until.In(location).Format(time.RFC3339), b.Interval, b.Lookahead)
+	} else {
+		b.until = time.Time{}
+		log.Println("Burst mode deactivated")
+	}
+	ch := b.changed
+	b.changed = nil
+	b.mu.Unlock()
+	if ch != nil {
+		close(ch)
+	}
+}
+
+// Active reports whether burst mode is active at t.
+func (b *BurstMode) Active(t time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.Before(b.until) {
+		return true
+	}
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range b.schedule {
+		if w.days[local.Weekday()] && minute >= w.start && minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns a channel closed on the next activation.
+func (b *BurstMode) Changed() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// PollInterval returns the interval until the next poll.
+func (b *BurstMode) PollInterval(interval time.Duration) time.Duration {
+	if b.Active(clock.Now()) && b.Interval < interval {
+		return b.Interval
+	}
+	return interval
+}
+
+// CurrentLookahead returns the number of days to look ahead.
+func (b *BurstMode) CurrentLookahead(lookahead int) int {
+	if b.Active(clock.Now()) && b.Lookahead > lookahead {
+		return b.Lookahead
+	}
+	return lookahead
+}
+
+// ServeHTTP reports the burst mode, or activates it with POST ?minutes=<n> (0 deactivates).
+// It must be guarded by AdminHandler.
+func (b *BurstMode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		minutes, err := strconv.Atoi(r.FormValue("minutes"))
+		if err != nil || minutes < 0 {
+			http.Error(w, "invalid minutes", http.StatusBadRequest)
+			return
+		}
+		b.Activate(time.Duration(minutes) * time.Minute)
+	}
+
+	b.mu.Lock()
+	until := b.until
+	b.mu.Unlock()
+	status := map[string]interface{}{
+		"active":    b.Active(clock.Now()),
+		"interval":  b.Interval.String(),
+		"lookahead": b.Lookahead,
+		"schedule":  b.ScheduleSpec,
+	}
+	if clock.Now().Before(until) {
+		status["until"] = until
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var calendarSlotDuration = flag.Duration("calendar-slot-duration", 15*time.Minute, "Duration of the events of slots with a known start in /calendar.ics")
+
+// CalendarHandler serves the next free slot of every vaccination type as iCalendar feed, so
+// calendar apps subscribed to it show the slots appear. Slots with only a known date are all
+// day events. The query parameters vaccine and booking_page restrict the feed.
+type CalendarHandler struct {
+	snapshot func() *Snapshot
+}
+
+func (h *CalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := h.snapshot()
+	if snap == nil {
+		http.Error(w, "no successful poll yet", http.StatusServiceUnavailable)
+		return
+	}
+	vaccine, bookingPage := r.URL.Query().Get("vaccine"), r.URL.Query().Get("booking_page")
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//impfe//Freie Impftermine//DE")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Freie Impftermine")
+	// clients ignoring this refresh at their own pace
+	minutes := pollIntervalMinutes()
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT%dM", minutes)
+	line("X-PUBLISHED-TTL:PT%dM", minutes)
+	stamp := snap.Time.UTC().Format("20060102T150405Z")
+	for _, o := range available(snap) {
+		e := NewAvailabilityEvent(o, snap.Time)
+		if (vaccine != "" && e.Vaccine != vaccine) || (bookingPage != "" && e.BookingPage != bookingPage) || o.NextSlot.IsZero() {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		// stable per series, so clients update the event instead of adding another
+		line("UID:%d-%d-%s-%s@impfe", o.Center.ID, o.MotiveID, o.Insurance, icsEscape(o.Center.BookingPage))
+		line("DTSTAMP:%s", stamp)
+		if e.Slot != nil {
+			line("DTSTART:%s", e.Slot.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND:%s", e.Slot.Start.Add(*calendarSlotDuration).UTC().Format("20060102T150405Z"))
+		} else {
+			line("DTSTART;VALUE=DATE:%s", o.NextSlot.Format("20060102"))
+			line("DTEND;VALUE=DATE:%s", o.NextSlot.AddDate(0, 0, 1).Format("20060102"))
+		}
+		line("SUMMARY:%s", icsEscape(fmt.Sprintf("%s: %s (%d Termine)", o.Center.Name, o.Motive, o.Slots)))
+		line("DESCRIPTION:%s", icsEscape(fmt.Sprintf("Naechster freier Termin, %d Termine frei. Stand %s.", o.Slots, FormatDate(snap.Time))))
+		if loc := strings.TrimSpace(o.Center.Zipcode + " " + o.Center.City); loc != "" {
+			line("LOCATION:%s", icsEscape(o.Center.Name+", "+loc))
+		}
+		line("URL:%s", DeepLink(e))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// pollIntervalMinutes returns the poll interval in whole minutes, at least one.
+func pollIntervalMinutes() int {
+	if m := int(pollInterval.Minutes()); m >= 1 {
+		return m
+	}
+	return 1
+}
+
+// icsEscape escapes a text value of iCalendar.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine splits a content line into lines of at most 75 octets, not splitting
+// UTF-8 sequences, and terminates it with CRLF.
+func foldICSLine(s string) string {
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xc0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// the leading space of continuation lines counts
+		limit = 74
+	}
+	b.WriteString(s + "\r\n")
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Hash returns a hash of the availabilities of the snapshot which is independent of the
+// order in which they were fetched and of values not relevant for events, like the poll time.
+func (s *Snapshot) Hash() uint64 {
+	lines := make([]string, 0, len(s.Observations))
+	for _, o := range s.Observations {
+		next := int64(0)
+		if !o.NextSlot.IsZero() {
+			next = o.NextSlot.Unix()
+		}
+		lines = append(lines, fmt.Sprintf("%s\x00%d\x00%s\x00%d\x00%s\x00%s\x00%d\x00%d",
+			o.Center.BookingPage, o.Center.ID, o.Center.Name, o.MotiveID, o.Motive, o.Insurance, next, o.Slots))
+	}
+	sort.Strings(lines)
+	h := fnv.New64a()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// Unchanged reports whether snap has the same availabilities as prev (which may be nil).
+func Unchanged(prev, snap *Snapshot) bool {
+	return prev != nil && prev.hash == snap.hash
+}
+
+// ChangeStats counts the polls with and without changed availabilities.
+type ChangeStats struct {
+	mu        sync.Mutex
+	changed   uint64
+	unchanged uint64
+
+	desc *prometheus.Desc
+}
+
+var changeStats = &ChangeStats{}
+
+// Record counts a poll.
+func (s *ChangeStats) Record(changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if changed {
+		s.changed++
+	} else {
+		s.unchanged++
+	}
+}
+
+func (s *ChangeStats) Describe(ch chan<- *prometheus.Desc) {
+	if s.desc == nil {
+		s.desc = prometheus.NewDesc("impfe_polls_total",
+			"Abfragen aller Impfzentren, je nachdem ob sich Verfuegbarkeiten geaendert haben",
+			[]string{"changed"}, nil,
+		)
+	}
+	ch <- s.desc
+}
+
+func (s *ChangeStats) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(s.desc, prometheus.CounterValue, float64(s.changed), "true")
+	ch <- prometheus.MustNewConstMetric(s.desc, prometheus.CounterValue, float64(s.unchanged), "false")
+}
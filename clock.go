@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+// Clock abstracts the current time and waiting so that time dependent behavior
+// (scheduling, lead times, opening hours) can be driven by a fake clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var clock Clock = realClock{}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// FakeClock is a Clock which only moves on Advance.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	// added is signalled whenever a waiter is added, see BlockUntil
+	added chan struct{}
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, added: make(chan struct{}, 1)}
+}
+
+// useFakeClock replaces the clock for the duration of the test.
+func useFakeClock(t *testing.T, now time.Time) *FakeClock {
+	c := NewFakeClock(now)
+	prev := clock
+	clock = c
+	t.Cleanup(func() { clock = prev })
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward and fires the waiters which are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// BlockUntil waits until n waiters are pending, so a goroutine calling After or Sleep
+// is known to wait before the clock is advanced.
+func (c *FakeClock) BlockUntil(t *testing.T, n int) {
+	timeout := time.After(5 * time.Second)
+	for {
+		c.mu.Lock()
+		pending := len(c.waiters)
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		select {
+		case <-c.added:
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %d waiters, got %d", n, pending)
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+
+	after := c.After(time.Minute)
+	c.Advance(59 * time.Second)
+	select {
+	case <-after:
+		t.Fatal("After fired before its duration passed")
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case now := <-after:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Errorf("After fired at %s, want %s", now, start.Add(time.Minute))
+		}
+	default:
+		t.Fatal("After did not fire once its duration passed")
+	}
+
+	select {
+	case <-c.After(0):
+	default:
+		t.Error("After(0) did not fire immediately")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Hour)
+		close(done)
+	}()
+	c.BlockUntil(t, 1)
+	c.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return after advancing the clock")
+	}
+	if got := c.Now(); !got.Equal(start.Add(time.Minute + time.Hour)) {
+		t.Errorf("Now() = %s, want %s", got, start.Add(time.Minute+time.Hour))
+	}
+}
+
+func TestCalendarDaysAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("Time zone data not available:", err)
+	}
+	defer func(prev *time.Location) { location = prev }(location)
+	location = berlin
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"same day", time.Date(2021, 3, 27, 8, 0, 0, 0, berlin), time.Date(2021, 3, 27, 23, 0, 0, 0, berlin), 0},
+		{"spring forward", time.Date(2021, 3, 27, 23, 30, 0, 0, berlin), time.Date(2021, 3, 28, 0, 30, 0, 0, berlin), 1},
+		{"two days over spring forward", time.Date(2021, 3, 27, 0, 0, 0, 0, berlin), time.Date(2021, 3, 29, 0, 0, 0, 0, berlin), 2},
+		{"fall back", time.Date(2021, 10, 30, 12, 0, 0, 0, berlin), time.Date(2021, 10, 31, 23, 59, 0, 0, berlin), 1},
+		{"week over fall back", time.Date(2021, 10, 28, 0, 0, 0, 0, berlin), time.Date(2021, 11, 4, 0, 0, 0, 0, berlin), 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalendarDays(tt.from, tt.to); got != tt.want {
+				t.Errorf("CalendarDays(%s, %s) = %d, want %d", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBurstModeExpires(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	b := &BurstMode{Interval: 10 * time.Second, Lookahead: 14}
+	if err := b.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Activate(10 * time.Minute)
+	c.Advance(9 * time.Minute)
+	if got := b.PollInterval(time.Minute); got != 10*time.Second {
+		t.Errorf("PollInterval during burst = %s, want 10s", got)
+	}
+	c.Advance(time.Minute)
+	if got := b.PollInterval(time.Minute); got != time.Minute {
+		t.Errorf("PollInterval after burst = %s, want 1m", got)
+	}
+	if got := b.CurrentLookahead(4); got != 4 {
+		t.Errorf("CurrentLookahead after burst = %d, want 4", got)
+	}
+}
+
+func TestRetryBacksOffOnTheClock(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+
+	var mu sync.Mutex
+	attempts := 0
+	result := make(chan error, 1)
+	go func() {
+		result <- Retry(context.Background(), policy, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return &doctolib.StatusError{Code: 503}
+		})
+	}()
+	for want := 1; want < policy.MaxAttempts; want++ {
+		c.BlockUntil(t, 1)
+		mu.Lock()
+		got := attempts
+		mu.Unlock()
+		if got != want {
+			t.Fatalf("attempts before backoff %d = %d, want %d", want, got, want)
+		}
+		// the jittered backoff is at most the doubled base delay
+		c.Advance(policy.Backoff(want) * 2)
+	}
+	select {
+	case err := <-result:
+		var statusErr *doctolib.StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("Retry returned %v, want the last error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry did not give up after the last attempt")
+	}
+	if attempts != policy.MaxAttempts {
+		t.Errorf("attempts = %d, want %d", attempts, policy.MaxAttempts)
+	}
+}
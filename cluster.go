@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cluster = &Cluster{}
+
+func init() {
+	flag.StringVar(&cluster.Dir, "cluster-dir", "", "Shared directory the instances of a cluster coordinate through, enables clustering")
+	flag.StringVar(&cluster.Instance, "cluster-instance", "", "Name of this instance within the cluster (default: host name)")
+	flag.DurationVar(&cluster.TTL, "cluster-ttl", 30*time.Second, "Time after which an instance without heartbeat leaves the cluster")
+	flag.IntVar(&cluster.StaticIndex, "shard-index", 0, "Shard of this instance when partitioning statically without a cluster directory")
+	flag.IntVar(&cluster.StaticCount, "shard-count", 1, "Number of shards when partitioning statically without a cluster directory")
+}
+
+// Cluster partitions the centers across several instances by hashing. The members
+// are either discovered through heartbeat files in a shared directory or given statically.
+type Cluster struct {
+	Dir         string
+	Instance    string
+	TTL         time.Duration
+	StaticIndex int
+	StaticCount int
+
+	mu      sync.Mutex
+	members []string
+
+	shardDesc   *prometheus.Desc
+	membersDesc *prometheus.Desc
+}
+
+// Setup validates the settings.
+func (c *Cluster) Setup() error {
+	if c.Dir == "" {
+		if c.StaticCount < 1 || c.StaticIndex < 0 || c.StaticIndex >= c.StaticCount {
+			return fmt.Errorf("Invalid shard %d of %d", c.StaticIndex, c.StaticCount)
+		}
+		return nil
+	}
+	if c.Instance == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("Failed to determine instance name: %s", err)
+		}
+		c.Instance = host
+	}
+	if strings.ContainsAny(c.Instance, `/\`) {
+		return fmt.Errorf("Invalid cluster instance name %q", c.Instance)
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("Cluster TTL must be positive, got %s", c.TTL)
+	}
+	return nil
+}
+
+// Join announces this instance in the cluster directory and discovers the other members.
+func (c *Cluster) Join() error {
+	if c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create cluster directory: %s", err)
+	}
+	if err := c.heartbeat(); err != nil {
+		return fmt.Errorf("Failed to join cluster: %s", err)
+	}
+	return nil
+}
+
+// Enabled reports whether the centers are partitioned.
+func (c *Cluster) Enabled() bool {
+	return c.Dir != "" || c.StaticCount > 1
+}
+
+// Run renews the heartbeat of this instance until ctx is done.
+func (c *Cluster) Run(ctx context.Context) {
+	if c.Dir == "" {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			os.Remove(filepath.Join(c.Dir, c.Instance))
+			return
+		case <-clock.After(c.TTL / 3):
+		}
+		if err := c.heartbeat(); err != nil {
+			log.Printf("Cluster heartbeat failed: %s", err)
+		}
+	}
+}
+
+// heartbeat touches the file of this instance and refreshes the live members.
+func (c *Cluster) heartbeat() error {
+	now := clock.Now()
+	if err := os.WriteFile(filepath.Join(c.Dir, c.Instance), []byte(now.Format(time.RFC3339)), 0644); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+	members := []string{c.Instance}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == c.Instance || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(c.Dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil && now.Sub(t) < c.TTL {
+			members = append(members, e.Name())
+		}
+	}
+	sort.Strings(members)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if strings.Join(members, ",") != strings.Join(c.members, ",") {
+		log.Printf("Cluster members changed to %s", strings.Join(members, ", "))
+	}
+	c.members = members
+	return nil
+}
+
+// Shard returns the shard of this instance and the number of shards.
+func (c *Cluster) Shard() (index, count int) {
+	if c.Dir == "" {
+		return c.StaticIndex, c.StaticCount
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, m := range c.members {
+		if m == c.Instance {
+			return i, len(c.members)
+		}
+	}
+	return 0, 1
+}
+
+// Partition returns the centers belonging to the shard of this instance.
+func (c *Cluster) Partition(centers []doctolib.Impfzentrum) []doctolib.Impfzentrum {
+	index, count := c.Shard()
+	if count <= 1 {
+		return centers
+	}
+	var own []doctolib.Impfzentrum
+	for _, center := range centers {
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%s/%d", center.BookingPage, center.ID)
+		if int(h.Sum32()%uint32(count)) == index {
+			own = append(own, center)
+		}
+	}
+	return own
+}
+
+func (c *Cluster) Describe(ch chan<- *prometheus.Desc) {
+	if c.shardDesc == nil {
+		c.shardDesc = prometheus.NewDesc("impfe_cluster_shard",
+			"Shard dieser Instanz",
+			[]string{"instance_name"}, nil,
+		)
+		c.membersDesc = prometheus.NewDesc("impfe_cluster_shards",
+			"Anzahl der Shards im Cluster",
+			nil, nil,
+		)
+	}
+	ch <- c.shardDesc
+	ch <- c.membersDesc
+}
+
+func (c *Cluster) Collect(ch chan<- prometheus.Metric) {
+	index, count := c.Shard()
+	ch <- prometheus.MustNewConstMetric(c.shardDesc, prometheus.GaugeValue, float64(index), c.Instance)
+	ch <- prometheus.MustNewConstMetric(c.membersDesc, prometheus.GaugeValue, float64(count))
+}
+
+// ShardLabel returns the value of the shard label of this instance.
+func ShardLabel() string {
+	index, _ := cluster.Shard()
+	return strconv.Itoa(index)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// once and quiet select the one-shot mode of the root command.
+var once, quiet bool
+
+// NewRootCommand returns the impfe command line. Running it without a subcommand starts the exporter.
+func NewRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "impfe",
+		Short: "Prometheus exporter for vaccination appointments on Doctolib",
+		Args:  cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return Setup(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if once {
+				output := OutputTable
+				if quiet {
+					output = OutputTSV
+				}
+				return RunOnce(cmd.Context(), os.Stdout, output)
+			}
+			return Serve(cmd.Context())
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	root.Flags().BoolVar(&once, "once", false, "Poll once, print the free slots and exit with 0 if there are any, 1 if not and 2 on errors")
+	root.Flags().BoolVar(&quiet, "quiet", false, "With --once, print only tab separated lines of the free slots and no logs")
+
+	root.AddCommand(&cobra.Command{
+		Use:   "targets",
+		Short: "Print the resolved monitoring plan and the estimated request rate",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunTargets(cmd.Context())
+		},
+	})
+
+	var checkOutput string
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Poll once and print the free slots, exiting with 0 if there are any, 1 if not and 2 on errors",
+		Args:  cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// setup errors must not be mistaken for no slots
+			once = true
+			return Setup(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunOnce(cmd.Context(), os.Stdout, checkOutput)
+		},
+	}
+	checkCmd.Flags().StringVarP(&checkOutput, "output", "o", OutputTable, "Output format (table, json, tsv)")
+	root.AddCommand(checkCmd)
+
+	var broadcastTitle string
+	broadcastCmd := &cobra.Command{
+		Use:   "broadcast <message>",
+		Short: "Send an operator message, e.g. about maintenance, through all configured notifiers",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunBroadcast(cmd.Context(), os.Stdout, broadcastTitle, strings.Join(args, " "))
+		},
+	}
+	broadcastCmd.Flags().StringVar(&broadcastTitle, "title", defaultBroadcastTitle, "Title of the message")
+	root.AddCommand(broadcastCmd)
+
+	var testBackend, testProfile string
+	notifyTestCmd := &cobra.Command{
+		Use:   "notify-test",
+		Short: "Send a test notification through the notifiers of one backend and report the result of each",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunNotifyTest(cmd.Context(), os.Stdout, testBackend, testProfile)
+		},
+	}
+	notifyTestCmd.Flags().StringVar(&testBackend, "backend", "", "Backend to test: telegram, webhook, slack, discord, ntfy, gotify or smtp")
+	notifyTestCmd.Flags().StringVar(&testProfile, "profile", "", "Only test the notifier with this profile from the notify section")
+	notifyTestCmd.MarkFlagRequired("backend")
+	root.AddCommand(notifyTestCmd)
+
+	var listOutput string
+	listCentersCmd := &cobra.Command{
+		Use:   "list-centers [booking-page...]",
+		Short: "List the places, practice IDs, agenda IDs and motives of booking pages, the configured ones by default",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = BookingPages()
+			}
+			return RunListCenters(cmd.Context(), os.Stdout, args, listOutput)
+		},
+	}
+	listCentersCmd.Flags().StringVarP(&listOutput, "output", "o", OutputTable, "Output format (table, json)")
+	root.AddCommand(listCentersCmd)
+
+	var watchInterval time.Duration
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Poll the availabilities and show them in a live updating table",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return Watch(cmd.Context(), os.Stdout, watchInterval)
+		},
+	}
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", time.Minute, "Poll interval")
+	root.AddCommand(watchCmd)
+
+	var tailFormat string
+	var tailInterval time.Duration
+	tailCmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Poll the availabilities and print every change to stdout",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return Tail(cmd.Context(), os.Stdout, tailFormat, tailInterval)
+		},
+	}
+	tailCmd.Flags().StringVar(&tailFormat, "format", "jsonl", "Output format (jsonl, text)")
+	tailCmd.Flags().DurationVar(&tailInterval, "interval", time.Minute, "Poll interval")
+	root.AddCommand(tailCmd)
+
+	var selfcheckFormat string
+	selfcheckCmd := &cobra.Command{
+		Use:   "selfcheck",
+		Short: "Check connectivity, parsing, storage and notifiers, e.g. before promoting a deployment",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunSelfCheck(cmd.Context(), os.Stdout, selfcheckFormat)
+		},
+	}
+	selfcheckCmd.Flags().StringVar(&selfcheckFormat, "format", "text", "Output format (text, json)")
+	root.AddCommand(selfcheckCmd)
+
+	var backupOut string
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Write the state files to a tar.gz archive, e.g. to move an instance to another host",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunBackup(os.Stdout, backupOut)
+		},
+	}
+	backupCmd.Flags().StringVar(&backupOut, "out", "impfe-backup.tar.gz", "Archive to write")
+	root.AddCommand(backupCmd)
+
+	var restoreForce bool
+	restoreCmd := &cobra.Command{
+		Use:   "restore <file.tar.gz>",
+		Short: "Restore the state files from an archive written by impfe backup before starting impfe",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunRestore(os.Stdout, args[0], restoreForce)
+		},
+	}
+	restoreCmd.Flags().BoolVar(&restoreForce, "force", false, "Replace existing state files")
+	root.AddCommand(restoreCmd)
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	var resolved bool
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the configuration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return PrintConfig(cmd.Flags(), resolved)
+		},
+	}
+	printCmd.Flags().BoolVar(&resolved, "resolved", false, "Print all settings including defaults together with their source")
+	configCmd.AddCommand(printCmd)
+	root.AddCommand(configCmd)
+
+	var manDir string
+	manCmd := &cobra.Command{
+		Use:   "man",
+		Short: "Generate man pages",
+		Args:  cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(manDir, 0755); err != nil {
+				return err
+			}
+			header := &doc.GenManHeader{Title: "IMPFE", Section: "1"}
+			if err := doc.GenManTree(root, header, manDir); err != nil {
+				return fmt.Errorf("Generating man pages failed: %s", err)
+			}
+			return nil
+		},
+	}
+	manCmd.Flags().StringVar(&manDir, "dir", ".", "Directory to write the man pages to")
+	root.AddCommand(manCmd)
+
+	return root
+}
+
+// Setup resolves and validates the settings and prepares the upstream client.
+func Setup(cmd *cobra.Command) error {
+	if err := ApplySettings(cmd.Flags()); err != nil {
+		return err
+	}
+	if once && quiet {
+		log.SetOutput(io.Discard)
+	}
+	if err := SetupLocale(); err != nil {
+		return err
+	}
+	if err := ValidateHolidayState(*holidayState); err != nil {
+		return err
+	}
+	if err := SetupBackup(); err != nil {
+		return err
+	}
+	if err := RestoreState(cmd.Context()); err != nil {
+		return err
+	}
+	if err := crawler.Load(*crawlStateFile); err != nil {
+		return err
+	}
+	if err := lifecycle.Load(*centerStateFile); err != nil {
+		return err
+	}
+	if err := mutes.Load(*muteStateFile); err != nil {
+		return err
+	}
+	if len(BookingPages()) == 0 && *crawlPlaces == "" && *replicaOf == "" {
+		return fmt.Errorf("No booking page configured")
+	}
+	if err := ValidateChannels(); err != nil {
+		return err
+	}
+	if err := ValidateInsuranceSectors(); err != nil {
+		return err
+	}
+	if _, err := ParseAges(); err != nil {
+		return err
+	}
+	if *workers < 1 {
+		return fmt.Errorf("Workers must be at least 1, got %d", *workers)
+	}
+	if err := SetupFilter(); err != nil {
+		return err
+	}
+	if err := SetupOverrides(); err != nil {
+		return err
+	}
+	if err := ValidateRegions(); err != nil {
+		return err
+	}
+	if len(config.Regions) > 0 {
+		motiveLabelNames = append(motiveLabelNames, "region")
+	}
+	if err := cluster.Setup(); err != nil {
+		return err
+	}
+	if cluster.Enabled() {
+		motiveLabelNames = append(motiveLabelNames, "shard")
+	}
+	if err := SetupReplica(); err != nil {
+		return err
+	}
+	if err := ValidateLabelNormalization(); err != nil {
+		return err
+	}
+	if err := SetupExternalLabels(); err != nil {
+		return err
+	}
+	if err := SetupRegistry(); err != nil {
+		return err
+	}
+	if err := SetupPush(); err != nil {
+		return err
+	}
+	if err := SetupRedaction(); err != nil {
+		return err
+	}
+	if err := SetupAdmin(); err != nil {
+		return err
+	}
+	if err := burst.Setup(); err != nil {
+		return err
+	}
+	if err := ResolveRetryPolicies(); err != nil {
+		return err
+	}
+	if err := SetupNotifiers(); err != nil {
+		return err
+	}
+	if *rateLimit < 0 {
+		return fmt.Errorf("Rate limit must not be negative, got %g", *rateLimit)
+	}
+	if *smoothingAlpha < 0 || *smoothingAlpha > 1 {
+		return fmt.Errorf("Smoothing alpha must be between 0 and 1, got %g", *smoothingAlpha)
+	}
+	if *centerRetention < 0 {
+		return fmt.Errorf("Center retention must not be negative, got %d", *centerRetention)
+	}
+	if *adaptiveLookahead < 0 || *adaptiveAfter < 1 {
+		return fmt.Errorf("Adaptive lookahead must not be negative and adaptive-after at least 1")
+	}
+	rand.Seed(time.Now().UnixNano())
+	client, err := NewHTTPClient()
+	if err != nil {
+		return err
+	}
+	if t := retryPolicies["doctolib"].Timeout; t > 0 {
+		client.Timeout = t
+	}
+	source = retrySource{doctolibSource{client: &doctolib.Client{
+		BaseURL:         doctolib.DefaultBaseURL,
+		HTTPClient:      client,
+		InsuranceSector: InsuranceSectors()[0],
+		Limit:           *lookahead,
+		OrphanAgenda:    scrapeStats.OrphanAgenda,
+	}, limiter: NewTokenBucket(*rateLimit, *rateBurst)}, retryPolicies["doctolib"]}
+	if *synthetic {
+		log.Println("Serving synthetic data, Doctolib will not be called")
+		source = NewSyntheticSource()
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are the configuration files given by --config, later ones override earlier ones.
+var configFiles configFileList
+
+func init() {
+	flag.Var(&configFiles, "config", "YAML configuration `file`, may be repeated or comma separated to layer files, later ones override earlier ones (default "+defaultConfigFilesUsage+")")
+}
+
+// systemConfigFile is the shared base configuration.
+const systemConfigFile = "/etc/impfe/config.yaml"
+
+const defaultConfigFilesUsage = systemConfigFile + " and impfe/config.yaml in the user config directory if they exist"
+
+// configFileList is a repeatable flag of file names.
+type configFileList []string
+
+func (l *configFileList) String() string { return strings.Join(*l, ",") }
+
+func (l *configFileList) Set(s string) error {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			*l = append(*l, f)
+		}
+	}
+	return nil
+}
+
+// defaultConfigFiles returns the system and the user configuration file which exist.
+func defaultConfigFiles() []string {
+	files := []string{systemConfigFile}
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "impfe", "config.yaml"))
+	}
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	return existing
+}
+
+// loadedConfigFiles are the configuration files the settings were read from.
+var loadedConfigFiles []string
+
+// configName names the loaded configuration files in error messages.
+func configName() string {
+	return strings.Join(loadedConfigFiles, ", ")
+}
+
+// Config is the content of the configuration file. Besides structured sections
+// it holds settings named like the command line flags, e.g. "poll-interval: 2m".
+type Config struct {
+	// Retry holds the retry policies per integration, e.g. "doctolib".
+	Retry map[string]RetryPolicy `yaml:"retry"`
+	// Regions maps postal codes to user defined regions, the first matching region wins.
+	Regions []RegionConfig `yaml:"regions"`
+	// Notify configures the notifiers.
+	Notify NotifyConfig `yaml:"notify"`
+	// Filters select the motives and centers to monitor.
+	Filters FilterConfig `yaml:"filters"`
+	// Centers override settings for some centers, e.g. a shorter poll interval.
+	Centers []CenterOverride `yaml:"centers"`
+	// Redaction extends the rules for scrubbing personal data.
+	Redaction RedactionConfig        `yaml:"redaction"`
+	Settings  map[string]interface{} `yaml:",inline"`
+}
+
+var config Config
+
+// LoadConfigs reads the configuration files and merges them in order: mappings are merged
+// key by key, any other value of a later file replaces the earlier one. It also returns the
+// file each setting named like a flag was last read from.
+func LoadConfigs(files []string) (Config, map[string]string, error) {
+	var c Config
+	merged := map[string]interface{}{}
+	origins := map[string]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return c, nil, fmt.Errorf("Reading config failed: %s", err)
+		}
+		var layer map[string]interface{}
+		if err := yaml.Unmarshal(data, &layer); err != nil {
+			return c, nil, fmt.Errorf("Failed to parse config %s: %s", file, err)
+		}
+		// each file has to be valid on its own so errors point to the right file
+		var fc Config
+		if err := decodeConfig(data, &fc); err != nil {
+			return c, nil, fmt.Errorf("Failed to parse config %s: %s", file, err)
+		}
+		for name := range fc.Settings {
+			origins[name] = file
+		}
+		mergeConfig(merged, layer)
+	}
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return c, nil, err
+	}
+	if err := decodeConfig(data, &c); err != nil {
+		return c, nil, fmt.Errorf("Failed to merge configs %s: %s", strings.Join(files, ", "), err)
+	}
+	return c, origins, nil
+}
+
+// decodeConfig decodes a config file. Unknown keys of the structured sections are rejected,
+// so typos do not silently disable a setting; other top-level keys end up in Settings and
+// are checked against the flags later.
+func decodeConfig(data []byte, c *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// mergeConfig merges layer into base.
+func mergeConfig(base, layer map[string]interface{}) {
+	for k, v := range layer {
+		if m, ok := v.(map[string]interface{}); ok {
+			if b, ok := base[k].(map[string]interface{}); ok {
+				mergeConfig(b, m)
+				continue
+			}
+		}
+		base[k] = v
+	}
+}
+
+// flagSources records where the value of each setting came from.
+var flagSources = map[string]string{}
+
+// EnvName returns the environment variable for a flag, e.g. IMPFE_POLL_INTERVAL for --poll-interval.
+func EnvName(name string) string {
+	return "IMPFE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// ApplySettings resolves the settings in the order built-in defaults < system config < user config
+// < environment < flags and loads the structured sections of the config files. Without --config
+// or IMPFE_CONFIG the system and the user config file are read if they exist. It must be called
+// after fs has been parsed.
+func ApplySettings(fs *pflag.FlagSet) error {
+	if f := fs.Lookup("config"); f != nil && !f.Changed {
+		if v, ok := os.LookupEnv(EnvName("config")); ok {
+			configFiles = nil
+			configFiles.Set(v)
+		} else {
+			configFiles = defaultConfigFiles()
+		}
+	}
+	config = Config{}
+	loadedConfigFiles = configFiles
+	origins := map[string]string{}
+	if len(configFiles) > 0 {
+		c, o, err := LoadConfigs(configFiles)
+		if err != nil {
+			return err
+		}
+		config, origins = c, o
+	}
+	names := make([]string, 0, len(config.Settings))
+	for name := range config.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("Unknown setting %q in config %s", name, origins[name])
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		if f.Changed {
+			flagSources[f.Name] = "flag"
+			return
+		}
+		flagSources[f.Name] = "default"
+		if f.Name == "config" {
+			if _, ok := os.LookupEnv(EnvName(f.Name)); ok {
+				flagSources[f.Name] = "env"
+			}
+			return
+		}
+		if v, ok := os.LookupEnv(EnvName(f.Name)); ok {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("Invalid value %q for %s: %s", v, EnvName(f.Name), e)
+				return
+			}
+			flagSources[f.Name] = "env"
+			return
+		}
+		if v, ok := config.Settings[f.Name]; ok {
+			value := fmt.Sprint(v)
+			if list, ok := v.([]interface{}); ok {
+				items := make([]string, 0, len(list))
+				for _, item := range list {
+					items = append(items, fmt.Sprint(item))
+				}
+				value = strings.Join(items, ",")
+			}
+			if e := fs.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("Invalid value %q for %s in config %s: %s", value, f.Name, origins[f.Name], e)
+				return
+			}
+			flagSources[f.Name] = "config " + origins[f.Name]
+		}
+	})
+	return err
+}
+
+// PrintConfig prints the settings which are not at their default, or all settings
+// together with their source if resolved is set.
+func PrintConfig(fs *pflag.FlagSet, resolved bool) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fs.VisitAll(func(f *pflag.Flag) {
+		source, ok := flagSources[f.Name]
+		if !ok || source == "default" && !resolved {
+			return
+		}
+		if resolved {
+			fmt.Fprintf(w, "%s\t%s\t# %s\n", f.Name, f.Value, source)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", f.Name, f.Value)
+		}
+	})
+	return w.Flush()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// writeConfig writes a config file into the temporary directory of the test.
+func writeConfig(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfigsLayers(t *testing.T) {
+	system := writeConfig(t, "system.yaml", `
+poll-interval: 2m
+lookahead: 7
+retry:
+  doctolib:
+    max-attempts: 5
+    base-delay: 2s
+regions:
+  - name: berlin
+    postal_codes: ["10"]
+`)
+	user := writeConfig(t, "user.yaml", `
+poll-interval: 30s
+retry:
+  doctolib:
+    base-delay: 500ms
+regions:
+  - name: potsdam
+    postal_codes: ["14"]
+`)
+	c, origins, err := LoadConfigs([]string{system, user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"overridden setting", c.Settings["poll-interval"], "30s"},
+		{"inherited setting", c.Settings["lookahead"], 7},
+		{"inherited key of section", c.Retry["doctolib"].MaxAttempts, 5},
+		{"overridden key of section", c.Retry["doctolib"].BaseDelay, 500 * time.Millisecond},
+		{"replaced list", len(c.Regions), 1},
+		{"replaced list entry", c.Regions[0].Name, "potsdam"},
+		{"nested key of list entry", c.Regions[0].PostalCodes[0], "14"},
+		{"origin of overridden setting", origins["poll-interval"], user},
+		{"origin of inherited setting", origins["lookahead"], system},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigsRejectsUnknownKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"list entry": "regions:\n  - name: berlin\n    zipcodes: [\"10\"]\n",
+		"section":    "retry:\n  doctolib:\n    max-attempt: 5\n",
+	} {
+		file := writeConfig(t, "config.yaml", content)
+		if _, _, err := LoadConfigs([]string{file}); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("%s: LoadConfigs() error = %v, want the unknown key rejected", name, err)
+		}
+	}
+}
+
+func TestApplySettingsLayers(t *testing.T) {
+	system := writeConfig(t, "system.yaml", "poll-interval: 2m\nlookahead: 7\n")
+	user := writeConfig(t, "user.yaml", "lookahead: 3\n")
+	unknown := writeConfig(t, "unknown.yaml", "poll-intervall: 1m\n")
+
+	tests := []struct {
+		name  string
+		args  []string
+		env   string
+		want  string
+		err   string
+		files []string
+	}{
+		{name: "repeated flag", args: []string{"--config", system, "--config", user}, want: "2m0s 3", files: []string{system, user}},
+		{name: "comma separated", args: []string{"--config", user + "," + system}, want: "2m0s 7", files: []string{user, system}},
+		{name: "flag overrides configs", args: []string{"--config", system, "--config", user, "--lookahead", "9"}, want: "2m0s 9"},
+		{name: "environment", env: system + "," + user, want: "2m0s 3", files: []string{system, user}},
+		{name: "unknown key names its file", args: []string{"--config", system, "--config", unknown}, err: `Unknown setting "poll-intervall" in config ` + unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFiles = nil
+			defer func() { configFiles, config = nil, Config{} }()
+			if tt.env != "" {
+				os.Setenv(EnvName("config"), tt.env)
+				defer os.Unsetenv(EnvName("config"))
+			}
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.AddGoFlag(flag.CommandLine.Lookup("config"))
+			interval := fs.Duration("poll-interval", time.Minute, "")
+			lookahead := fs.Int("lookahead", 4, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := ApplySettings(fs)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ApplySettings() = %v, want error %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%s %d", *interval, *lookahead); got != tt.want {
+				t.Errorf("settings = %s, want %s", got, tt.want)
+			}
+			if tt.files != nil && strings.Join(loadedConfigFiles, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("loaded %v, want %v", loadedConfigFiles, tt.files)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var confirmSlots = flag.Bool("confirm-slots", false, "Fetch the next slot of new availabilities again before notifying to detect slots already held by other users")
+
+// Confidence levels of a notified slot.
+const (
+	// ConfidenceConfirmed slots were still bookable when fetched again.
+	ConfidenceConfirmed = "confirmed"
+	// ConfidenceListed slots were only seen in the listing and vanished when fetched again,
+	// usually because another user is holding them.
+	ConfidenceListed = "listed"
+)
+
+// ConfirmSlots fetches the next slot of each alert again from its agenda
+// and sets the confidence of the notification. Notifications without a known slot are kept as they are.
+func ConfirmSlots(ctx context.Context, notifications []Notification) {
+	for i, n := range notifications {
+		if !n.Alert || n.Event.Slot == nil {
+			continue
+		}
+		confirmed, err := slotListed(ctx, n.Event)
+		if err != nil {
+			cycleLogger(n.Event.Cycle).Printf("Failed to confirm slot of %s: %s", n.Title(), err)
+			continue
+		}
+		notifications[i].Confidence = ConfidenceConfirmed
+		if !confirmed {
+			cycleLogger(n.Event.Cycle).Printf("Slot %s of %s vanished, probably held by another user", n.Event.Slot.Start.Format("2006-01-02 15:04"), n.Title())
+			notifications[i].Confidence = ConfidenceListed
+		}
+	}
+}
+
+// slotListed reports whether the agenda of the next slot of the event still offers it
+// for the insurance sector of the event.
+func slotListed(ctx context.Context, e AvailabilityEvent) (bool, error) {
+	if e.Insurance != "" {
+		ctx = WithInsuranceSector(ctx, e.Insurance)
+	}
+	r, err := source.GetAvailabilities(ctx, e.Slot.PracticeID, e.MotiveID, []int{e.Slot.AgendaID})
+	var statusErr *doctolib.StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, a := range r.Availabilities {
+		for _, s := range a.Slots {
+			if t, err := ParseSlotTime(s.Start); err == nil && t.Equal(e.Slot.Start) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
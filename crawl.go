@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	crawlPlaces     = flag.String("crawl-places", "", "Comma separated places to discover booking pages in via the Doctolib search, e.g. berlin,hamburg (empty disables crawling)")
+	crawlSpeciality = flag.String("crawl-speciality", "impfung-covid-19-corona", "Speciality to search for when crawling")
+	crawlInterval   = flag.Duration("crawl-interval", 6*time.Hour, "Interval between two crawls")
+	crawlMaxPages   = flag.Int("crawl-max-pages", 5, "Maximum search result pages per place and crawl")
+	crawlMaxTargets = flag.Int("crawl-max-targets", 50, "Maximum number of discovered booking pages added to the monitoring plan")
+	crawlStateFile  = flag.String("crawl-state-file", "", "JSON file persisting the discovered booking pages across restarts")
+)
+
+// defaultPageCost is the estimated requests per poll of a booking page before any was polled.
+const defaultPageCost = 5
+
+// DiscoveredTarget is a booking page found by the crawler.
+type DiscoveredTarget struct {
+	BookingPage  string    `json:"booking_page"`
+	Name         string    `json:"name"`
+	Zipcode      string    `json:"zipcode,omitempty"`
+	City         string    `json:"city,omitempty"`
+	Link         string    `json:"link,omitempty"`
+	Place        string    `json:"place"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// Crawler discovers booking pages via the Doctolib search and adds them to the
+// monitoring plan as long as the request rate stays below the ceiling.
+type Crawler struct {
+	mu         sync.Mutex
+	discovered map[string]DiscoveredTarget
+	lastRun    time.Time
+	pages      uint64
+	errors     uint64
+	skipped    uint64
+
+	// snapshot returns the latest snapshot to estimate the cost of a booking page, may be nil.
+	snapshot func() *Snapshot
+
+	pagesDesc      *prometheus.Desc
+	errorsDesc     *prometheus.Desc
+	skippedDesc    *prometheus.Desc
+	discoveredDesc *prometheus.Desc
+	lastRunDesc    *prometheus.Desc
+}
+
+var crawler = &Crawler{discovered: map[string]DiscoveredTarget{}}
+
+// Load reads the persisted targets, a missing file is no error.
+func (c *Crawler) Load(file string) error {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Reading crawl state failed: %s", err)
+	}
+	var targets []DiscoveredTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return fmt.Errorf("Failed to parse crawl state %s: %s", file, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range targets {
+		c.discovered[t.BookingPage] = t
+	}
+	return nil
+}
+
+// save persists the discovered targets, c.mu must be held.
+func (c *Crawler) save(file string) error {
+	if file == "" {
+		return nil
+	}
+	targets := make([]DiscoveredTarget, 0, len(c.discovered))
+	for _, t := range c.discovered {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].BookingPage < targets[j].BookingPage })
+	data, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Pages returns the discovered booking pages.
+func (c *Crawler) Pages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pages := make([]string, 0, len(c.discovered))
+	for p := range c.discovered {
+		pages = append(pages, p)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// Target returns the discovered target of a booking page.
+func (c *Crawler) Target(bookingPage string) (DiscoveredTarget, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.discovered[bookingPage]
+	return t, ok
+}
+
+// Run crawls every crawl interval until ctx is done.
+func (c *Crawler) Run(ctx context.Context) {
+	if *crawlPlaces == "" {
+		return
+	}
+	for {
+		c.Crawl(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(*crawlInterval):
+		}
+	}
+}
+
+// pageCost estimates the requests per poll of one booking page from the latest snapshot.
+func (c *Crawler) pageCost() float64 {
+	var snap *Snapshot
+	if c.snapshot != nil {
+		snap = c.snapshot()
+	}
+	if snap == nil || len(BookingPages()) == 0 {
+		return defaultPageCost
+	}
+	return float64(snap.Planned) / float64(len(BookingPages()))
+}
+
+// Crawl searches all configured places once and adds new booking pages within the budget.
+func (c *Crawler) Crawl(ctx context.Context) {
+	known := map[string]bool{}
+	for _, p := range BookingPages() {
+		known[p] = true
+	}
+	cost := c.pageCost()
+	planned := float64(len(BookingPages())) * cost
+	added := 0
+	for _, place := range strings.Split(*crawlPlaces, ",") {
+		place = strings.TrimSpace(place)
+		if place == "" {
+			continue
+		}
+		for page := 1; page <= *crawlMaxPages && ctx.Err() == nil; page++ {
+			r, err := source.Search(ctx, *crawlSpeciality, place, page)
+			c.mu.Lock()
+			c.pages++
+			if err != nil {
+				c.errors++
+			}
+			c.mu.Unlock()
+			if err != nil {
+				log.Printf("Failed to search %s in %s: %s", *crawlSpeciality, place, err)
+				break
+			}
+			for _, d := range r.Data.Doctors {
+				slug := d.BookingPage()
+				if slug == "" || slug == "." || known[slug] {
+					continue
+				}
+				known[slug] = true
+				c.mu.Lock()
+				full := len(c.discovered) >= *crawlMaxTargets
+				exceeds := *maxRequestsPerHour > 0 && RequestsPerHour(int(planned+cost), *pollInterval) > *maxRequestsPerHour
+				if full || exceeds {
+					c.skipped++
+					c.mu.Unlock()
+					continue
+				}
+				c.discovered[slug] = DiscoveredTarget{BookingPage: slug, Name: d.Name, Zipcode: d.Zipcode, City: d.City, Link: doctolib.DefaultBaseURL + d.Link, Place: place, DiscoveredAt: clock.Now()}
+				c.mu.Unlock()
+				planned += cost
+				added++
+			}
+			if len(r.Data.Doctors) == 0 {
+				break
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRun = clock.Now()
+	log.Printf("Crawl finished, added %d booking pages, %d discovered in total, %d skipped over budget", added, len(c.discovered), c.skipped)
+	if err := c.save(*crawlStateFile); err != nil {
+		log.Printf("Failed to save crawl state: %s", err)
+	}
+}
+
+func (c *Crawler) Describe(ch chan<- *prometheus.Desc) {
+	if c.pagesDesc == nil {
+		c.pagesDesc = prometheus.NewDesc("impfe_crawl_result_pages_total",
+			"Abgefragte Suchergebnisseiten",
+			nil, nil,
+		)
+		c.errorsDesc = prometheus.NewDesc("impfe_crawl_errors_total",
+			"Fehlgeschlagene Suchanfragen",
+			nil, nil,
+		)
+		c.skippedDesc = prometheus.NewDesc("impfe_crawl_skipped_targets_total",
+			"Gefundene Buchungsseiten, die wegen des Anfragebudgets nicht ueberwacht werden",
+			nil, nil,
+		)
+		c.discoveredDesc = prometheus.NewDesc("impfe_crawl_discovered_targets",
+			"Anzahl der gefundenen und ueberwachten Buchungsseiten",
+			nil, nil,
+		)
+		c.lastRunDesc = prometheus.NewDesc("impfe_crawl_last_run_timestamp_seconds",
+			"Zeitpunkt der letzten Suche",
+			nil, nil,
+		)
+	}
+	ch <- c.pagesDesc
+	ch <- c.errorsDesc
+	ch <- c.skippedDesc
+	ch <- c.discoveredDesc
+	ch <- c.lastRunDesc
+}
+
+func (c *Crawler) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.pagesDesc, prometheus.CounterValue, float64(c.pages))
+	ch <- prometheus.MustNewConstMetric(c.errorsDesc, prometheus.CounterValue, float64(c.errors))
+	ch <- prometheus.MustNewConstMetric(c.skippedDesc, prometheus.CounterValue, float64(c.skipped))
+	ch <- prometheus.MustNewConstMetric(c.discoveredDesc, prometheus.GaugeValue, float64(len(c.discovered)))
+	if !c.lastRun.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastRunDesc, prometheus.GaugeValue, float64(c.lastRun.Unix()))
+	}
+}
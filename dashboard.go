@@ -0,0 +1,86 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardRow is a vaccination type at a center on the dashboard.
+type dashboardRow struct {
+	Center, Motive, Vaccine string
+	Insurance               string
+	Disabled                bool
+	NextSlot                string
+	Slots                   int
+	Link                    string
+}
+
+// Dashboard renders the latest snapshot as auto-refreshing HTML table on /.
+type Dashboard struct {
+	snapshot func() *Snapshot
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data := struct {
+		Time    time.Time
+		Refresh int
+		Centers int
+		// Insurance is set if several insurance sectors are queried.
+		Insurance bool
+		Rows      []dashboardRow
+	}{Refresh: 60}
+	if snap := d.snapshot(); snap != nil {
+		data.Time = snap.Time.In(location)
+		data.Centers = len(snap.Centers)
+		observed := map[seriesKey]Observation{}
+		for _, o := range snap.Observations {
+			observed[o.key()] = o
+		}
+		sectors := InsuranceSectors()
+		data.Insurance = len(sectors) > 1
+		for _, c := range snap.Centers {
+			link := BookingLink(c.BookingPage)
+			for _, name := range c.Vaccination {
+				for _, sector := range sectors {
+					row := dashboardRow{Center: c.Name, Motive: name, Vaccine: VaccineLabel(name), Insurance: sector, NextSlot: "-", Link: link}
+					if o, ok := observed[seriesKey{keyOfCenter(c), name, sector}]; ok {
+						row.Slots = o.Slots
+						if !o.NextSlot.IsZero() {
+							row.NextSlot = FormatDate(o.NextSlot)
+						}
+					}
+					data.Rows = append(data.Rows, row)
+				}
+			}
+			for _, name := range c.DisabledVaccination {
+				data.Rows = append(data.Rows, dashboardRow{Center: c.Name, Motive: name, Vaccine: VaccineLabel(name), Disabled: true, NextSlot: "-", Link: link})
+			}
+		}
+		sort.Slice(data.Rows, func(i, j int) bool {
+			if data.Rows[i].Center != data.Rows[j].Center {
+				return data.Rows[i].Center < data.Rows[j].Center
+			}
+			if data.Rows[i].Motive != data.Rows[j].Motive {
+				return data.Rows[i].Motive < data.Rows[j].Motive
+			}
+			return data.Rows[i].Insurance < data.Rows[j].Insurance
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render dashboard: %s", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var (
+	notifyCooldown    = flag.Duration("notify-cooldown", 30*time.Minute, "Minimum time between two alerts about the same vaccine at a center (0 disables)")
+	notifyEarlierDays = flag.Int("notify-earlier-days", 0, "Also alert when the next slot moved earlier by at least this many days (0 disables)")
+)
+
+// Deduplicator silences repeated alerts about the same vaccine at a center within the cooldown.
+type Deduplicator struct {
+	mu       sync.Mutex
+	notified map[seriesKey]time.Time
+}
+
+var dedup = &Deduplicator{notified: map[seriesKey]time.Time{}}
+
+// alertKey identifies the vaccine of a notification at its center, falling back
+// to the motive if the vaccine is unknown.
+func alertKey(n Notification) seriesKey {
+	center := centerKey{n.Event.BookingPage, n.Event.PracticeID}
+	if n.Event.Vaccine != "" {
+		return seriesKey{center, n.Event.Vaccine, n.Event.Insurance}
+	}
+	return seriesKey{center, n.Event.Motive, n.Event.Insurance}
+}
+
+// Filter clears the alert flag of notifications about a vaccine at a center which
+// was alerted less than the cooldown before now, and records the remaining alerts.
+func (d *Deduplicator) Filter(notifications []Notification, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, n := range notifications {
+		if !n.Alert {
+			continue
+		}
+		key := alertKey(n)
+		if last, ok := d.notified[key]; ok && *notifyCooldown > 0 && now.Sub(last) < *notifyCooldown {
+			notifications[i].Alert = false
+			continue
+		}
+		d.notified[key] = now
+	}
+	// forget expired entries to not grow with every center ever seen
+	for key, last := range d.notified {
+		if now.Sub(last) >= *notifyCooldown {
+			delete(d.notified, key)
+		}
+	}
+}
+
+// Forget drops the alerts about a center.
+func (d *Deduplicator) Forget(center centerKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.notified {
+		if key.center == center {
+			delete(d.notified, key)
+		}
+	}
+}
+
+// movedEarlier returns the number of days the next slot moved earlier since the previous poll,
+// zero if it did not or there was none before or after.
+func movedEarlier(prev Observation, e AvailabilityEvent) int {
+	next, err := ParseSlotTime(e.NextSlot)
+	if err != nil || prev.NextSlot.IsZero() {
+		return 0
+	}
+	if days := CalendarDays(next, prev.NextSlot); days > 0 {
+		return days
+	}
+	return 0
+}
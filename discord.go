@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DiscordConfig configures a Discord webhook.
+type DiscordConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	// Username overrides the name of the webhook in the channel.
+	Username  string          `yaml:"username"`
+	Template  MessageTemplate `yaml:"template"`
+	Selection `yaml:",inline"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Pool spreads the notifications over the notifiers of the backend with the same pool, see NotifierPool.
+	Pool string `yaml:"pool"`
+}
+
+// DiscordNotifier posts notifications as embeds to a Discord webhook.
+type DiscordNotifier struct {
+	selector
+	config DiscordConfig
+	format messageFormat
+	client *http.Client
+}
+
+// NewDiscordNotifier validates the config and returns the notifier.
+func NewDiscordNotifier(c DiscordConfig) (*DiscordNotifier, error) {
+	if !strings.HasPrefix(c.WebhookURL, "https://") {
+		return nil, fmt.Errorf("Discord notifier needs a https webhook_url")
+	}
+	sel, err := newSelector(c.Selection)
+	if err != nil {
+		return nil, err
+	}
+	format, err := newMessageFormat(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscordNotifier{selector: sel, config: c, format: format, client: notifierHTTPClient("discord")}, nil
+}
+
+func (d *DiscordNotifier) Name() string { return "discord" }
+
+// discordMaxEmbeds is the limit of embeds per message.
+const discordMaxEmbeds = 10
+
+func (d *DiscordNotifier) Notify(ctx context.Context, n Notification) error {
+	var embeds []map[string]interface{}
+	if d.format.custom() {
+		embeds = append(embeds, map[string]interface{}{
+			"title":       d.format.Title(n),
+			"url":         n.Link,
+			"description": d.format.Text(n),
+			"color":       0x2e7d32,
+			"timestamp":   n.Event.Time.Format(time.RFC3339),
+		})
+	} else {
+		for _, m := range n.Members() {
+			if len(embeds) == discordMaxEmbeds {
+				break
+			}
+			embeds = append(embeds, map[string]interface{}{
+				"title":       m.Event.Center,
+				"url":         m.Link,
+				"description": m.Event.Motive,
+				"color":       0x2e7d32,
+				"timestamp":   m.Event.Time.Format(time.RFC3339),
+				"fields": []map[string]interface{}{
+					{"name": "Naechster Termin", "value": nextSlotText(m), "inline": true},
+					{"name": "Freie Termine", "value": fmt.Sprint(m.Event.Slots), "inline": true},
+				},
+			})
+		}
+	}
+	msg := map[string]interface{}{
+		"embeds": embeds,
+		// mentions in center names must not ping anyone
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	if len(n.Group) > 1 {
+		msg["content"] = n.Title()
+	}
+	if d.config.Username != "" {
+		msg["username"] = d.config.Username
+	}
+	return postJSON(ctx, d.client, d.config.WebhookURL, msg)
+}
+
+func (d *DiscordNotifier) Broadcast(ctx context.Context, title, text string) error {
+	msg := map[string]interface{}{
+		"embeds": []map[string]interface{}{{
+			"title":       title,
+			"description": text,
+			"color":       0xf9a825,
+			"timestamp":   clock.Now().Format(time.RFC3339),
+		}},
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	if d.config.Username != "" {
+		msg["username"] = d.config.Username
+	}
+	return postJSON(ctx, d.client, d.config.WebhookURL, msg)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Egress is a local source address or proxy used for upstream requests.
+type Egress struct {
+	Name   string
+	Weight int
+
+	transport   http.RoundTripper
+	current     int
+	bannedUntil time.Time
+	requests    uint64
+	blocked     uint64
+}
+
+// EgressPool rotates upstream requests across several egresses. Egresses which get
+// blocked are skipped for BanDuration as long as there are others left.
+type EgressPool struct {
+	Weighted    bool
+	BanDuration time.Duration
+
+	mu       sync.Mutex
+	egresses []*Egress
+	next     int
+
+	requestsDesc *prometheus.Desc
+	blockedDesc  *prometheus.Desc
+	bannedDesc   *prometheus.Desc
+}
+
+// NewEgressPool parses a comma separated list of local IPs or proxy URLs, each optionally
+// followed by *weight, e.g. "192.0.2.10,192.0.2.11*2,http://proxy.example:3128".
+func NewEgressPool(spec string, fingerprint string) (*EgressPool, error) {
+	pool := &EgressPool{
+		requestsDesc: prometheus.NewDesc("impfe_egress_requests_total",
+			"Anzahl der Anfragen je Egress",
+			[]string{"egress"}, nil,
+		),
+		blockedDesc: prometheus.NewDesc("impfe_egress_blocked_total",
+			"Anzahl der blockierten Anfragen je Egress",
+			[]string{"egress"}, nil,
+		),
+		bannedDesc: prometheus.NewDesc("impfe_egress_banned",
+			"Egress wird wegen blockierter Anfragen nicht verwendet",
+			[]string{"egress"}, nil,
+		),
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		e := &Egress{Name: entry, Weight: 1}
+		if i := strings.LastIndex(entry, "*"); i >= 0 {
+			w, err := strconv.Atoi(entry[i+1:])
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("Invalid weight in egress %q", entry)
+			}
+			e.Name, e.Weight = entry[:i], w
+		}
+
+		var err error
+		if strings.Contains(e.Name, "://") {
+			proxy, perr := url.Parse(e.Name)
+			if perr != nil {
+				return nil, fmt.Errorf("Invalid egress proxy %q: %s", e.Name, perr)
+			}
+			e.transport, err = NewTransport(fingerprint, NewDialer(nil), proxy)
+		} else {
+			ip := net.ParseIP(e.Name)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid egress address %q", e.Name)
+			}
+			e.transport, err = NewTransport(fingerprint, NewDialer(ip), nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pool.egresses = append(pool.egresses, e)
+	}
+	if len(pool.egresses) == 0 {
+		return nil, fmt.Errorf("No egress configured")
+	}
+	return pool, nil
+}
+
+func (p *EgressPool) pick() *Egress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clock.Now()
+	candidates := make([]*Egress, 0, len(p.egresses))
+	for _, e := range p.egresses {
+		if now.After(e.bannedUntil) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.egresses
+	}
+
+	var picked *Egress
+	if p.Weighted {
+		// smooth weighted round robin
+		total := 0
+		for _, e := range candidates {
+			e.current += e.Weight
+			total += e.Weight
+			if picked == nil || e.current > picked.current {
+				picked = e
+			}
+		}
+		picked.current -= total
+	} else {
+		picked = candidates[p.next%len(candidates)]
+		p.next++
+	}
+	picked.requests++
+	return picked
+}
+
+func (p *EgressPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := p.pick()
+	resp, err := e.transport.RoundTrip(req)
+	if err == nil && IsBlocked(resp.StatusCode) {
+		p.mu.Lock()
+		e.blocked++
+		e.bannedUntil = clock.Now().Add(p.BanDuration)
+		p.mu.Unlock()
+		log.Printf("Egress %s got blocked (%s), not using it until %s", e.Name, resp.Status, e.bannedUntil.Format(time.RFC3339))
+	}
+	return resp, err
+}
+
+func (p *EgressPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.requestsDesc
+	ch <- p.blockedDesc
+	ch <- p.bannedDesc
+}
+
+func (p *EgressPool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clock.Now()
+	for _, e := range p.egresses {
+		banned := 0.0
+		if now.Before(e.bannedUntil) {
+			banned = 1
+		}
+		ch <- prometheus.MustNewConstMetric(p.requestsDesc, prometheus.CounterValue, float64(e.requests), e.Name)
+		ch <- prometheus.MustNewConstMetric(p.blockedDesc, prometheus.CounterValue, float64(e.blocked), e.Name)
+		ch <- prometheus.MustNewConstMetric(p.bannedDesc, prometheus.GaugeValue, banned, e.Name)
+	}
+}
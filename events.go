@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+)
+
+// AvailabilityEvent describes a change of the availability of a vaccination type at a center.
+type AvailabilityEvent struct {
+	// SchemaVersion is EventSchemaVersion, see /api/v1/schema.
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Center        string    `json:"center"`
+	BookingPage   string    `json:"booking_page"`
+	PracticeID    int       `json:"practice_id"`
+	MotiveID      int       `json:"motive_id"`
+	Motive        string    `json:"motive"`
+	Channel       string    `json:"channel"`
+	AgeGroup      string    `json:"age_group"`
+	Vaccine       string    `json:"vaccine,omitempty"`
+	Dose          string    `json:"dose"`
+	Insurance     string    `json:"insurance"`
+	NextSlot      string    `json:"next_slot,omitempty"`
+	Slots         int       `json:"slots"`
+	// Slot identifies the next free slot if known.
+	Slot *SlotRef `json:"slot,omitempty"`
+	// Cycle is the correlation ID of the poll which found the change, as in its log lines.
+	Cycle string `json:"cycle,omitempty"`
+}
+
+// SlotRef identifies a bookable slot.
+type SlotRef struct {
+	Start      time.Time `json:"start"`
+	PracticeID int       `json:"practice_id"`
+	AgendaID   int       `json:"agenda_id"`
+}
+
+// key returns the series of the event.
+func (e AvailabilityEvent) key() seriesKey {
+	return seriesKey{centerKey{e.BookingPage, e.PracticeID}, e.Motive, e.Insurance}
+}
+
+// Events returns an event for each observation of snap which differs from the previous snapshot prev (which may be nil).
+func Events(prev, snap *Snapshot) []AvailabilityEvent {
+	previous := map[seriesKey]Observation{}
+	if prev != nil {
+		for _, o := range prev.Observations {
+			previous[o.key()] = o
+		}
+	}
+	var events []AvailabilityEvent
+	for _, o := range snap.Observations {
+		if p, ok := previous[o.key()]; ok && p.NextSlot.Equal(o.NextSlot) && p.Slots == o.Slots {
+			continue
+		}
+		e := NewAvailabilityEvent(o, snap.Time)
+		e.Cycle = snap.Cycle
+		events = append(events, e)
+	}
+	return events
+}
+
+// NewAvailabilityEvent describes the availability of an observation at time t.
+func NewAvailabilityEvent(o Observation, t time.Time) AvailabilityEvent {
+	e := AvailabilityEvent{
+		SchemaVersion: EventSchemaVersion,
+		Time:          t,
+		Center:        o.Center.Name,
+		BookingPage:   o.Center.BookingPage,
+		PracticeID:    o.Center.ID,
+		MotiveID:      o.MotiveID,
+		Motive:        o.Motive,
+		Channel:       o.Center.Channel(o.MotiveID),
+		AgeGroup:      ParseAgeGroup(o.Motive).String(),
+		Dose:          DoseLabel(o.Motive),
+		Insurance:     o.Insurance,
+		Slots:         o.Slots,
+	}
+	if v, ok := VaccineForMotive(o.Motive); ok {
+		e.Vaccine = v.ID
+	}
+	if !o.NextSlot.IsZero() {
+		e.NextSlot = o.NextSlot.Format("2006-01-02")
+	}
+	if o.NextSlotAgenda != 0 {
+		e.Slot = &SlotRef{Start: o.NextSlotTime, PracticeID: o.NextSlotPractice, AgendaID: o.NextSlotAgenda}
+	}
+	return e
+}
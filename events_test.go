@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+func TestCycleIDReachesEvents(t *testing.T) {
+	ctx, _ := NewCycle(context.Background())
+	id := CycleID(ctx)
+	if len(id) != 8 {
+		t.Fatalf("CycleID() = %q, want 8 hex digits", id)
+	}
+	if got := CycleID(context.Background()); got != "" {
+		t.Errorf("CycleID outside of a cycle = %q, want empty", got)
+	}
+
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	center := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel", BookingPage: "ciz-berlin-berlin", Vaccination: map[int]string{7: "Erstimpfung"}}
+	prev := &Snapshot{Time: now, Centers: []doctolib.Impfzentrum{center}, Observations: []Observation{{Center: center, MotiveID: 7, Motive: "Erstimpfung"}},
+		Cycle: "00000001"}
+	day := Day(now).AddDate(0, 0, 2)
+	snap := &Snapshot{Time: now.Add(time.Minute), Centers: []doctolib.Impfzentrum{center},
+		Observations: []Observation{{Center: center, MotiveID: 7, Motive: "Erstimpfung", Slots: 3, NextSlot: day, NextSlotTime: day}}, Cycle: id}
+
+	for _, e := range StreamEvents(prev, snap) {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"cycle":"`+id+`"`) {
+			t.Errorf("%s event %s lacks the cycle %s", e.Kind, data, id)
+		}
+	}
+	notifications := Notifications(prev, snap)
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notifications))
+	}
+	if got := notifications[0].Event.Cycle; got != id {
+		t.Errorf("notification cycle = %q, want %q", got, id)
+	}
+	data, err := json.Marshal(WebhookPayload{AvailabilityEvent: notifications[0].Event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"cycle":"`+id+`"`) {
+		t.Errorf("webhook payload %s lacks the cycle %s", data, id)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// FilterConfig is the filters section of the config file. Entries of the motive lists
+// are visit motive IDs or regular expressions on the motive name, entries of the
+// center lists are practice IDs or regular expressions on the center name. Excludes win over includes,
+// empty include lists include everything.
+type FilterConfig struct {
+	Motives struct {
+		Include []string `yaml:"include"`
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"motives"`
+	Centers struct {
+		Include []string `yaml:"include"`
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"centers"`
+}
+
+// matcher matches IDs and names.
+type matcher struct {
+	ids      map[int]bool
+	patterns []*regexp.Regexp
+}
+
+func newMatcher(entries []string, ids bool) (*matcher, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	m := &matcher{ids: map[int]bool{}}
+	for _, e := range entries {
+		if id, err := strconv.Atoi(e); ids && err == nil {
+			m.ids[id] = true
+			continue
+		}
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid filter %q: %s", e, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+func (m *matcher) match(id int, name string) bool {
+	if m.ids[id] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter decides which centers and motives are scraped and exported.
+type Filter struct {
+	includeMotives, excludeMotives *matcher
+	includeCenters, excludeCenters *matcher
+}
+
+// filter built from the config file, nil if nothing is filtered.
+var filter *Filter
+
+// SetupFilter compiles the filters section of the config file.
+func SetupFilter() error {
+	f := &Filter{}
+	var err error
+	fc := config.Filters
+	if f.includeMotives, err = newMatcher(fc.Motives.Include, true); err != nil {
+		return err
+	}
+	if f.excludeMotives, err = newMatcher(fc.Motives.Exclude, true); err != nil {
+		return err
+	}
+	if f.includeCenters, err = newMatcher(fc.Centers.Include, true); err != nil {
+		return err
+	}
+	if f.excludeCenters, err = newMatcher(fc.Centers.Exclude, true); err != nil {
+		return err
+	}
+	filter = f
+	return nil
+}
+
+// Center reports whether a center is monitored.
+func (f *Filter) Center(center doctolib.Impfzentrum) bool {
+	if f == nil {
+		return true
+	}
+	if f.excludeCenters != nil && f.excludeCenters.match(center.ID, center.Name) {
+		return false
+	}
+	return f.includeCenters == nil || f.includeCenters.match(center.ID, center.Name)
+}
+
+// Motive reports whether a motive is monitored.
+func (f *Filter) Motive(id int, name string) bool {
+	if f == nil {
+		return true
+	}
+	if f.excludeMotives != nil && f.excludeMotives.match(id, name) {
+		return false
+	}
+	return f.includeMotives == nil || f.includeMotives.match(id, name)
+}
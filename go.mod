@@ -2,4 +2,11 @@ module github.com/databus23/impfe
 
 go 1.16
 
-require github.com/prometheus/client_golang v1.10.0
+require (
+	github.com/prometheus/client_golang v1.10.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/refraction-networking/utls v1.1.5
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GotifyConfig configures an application of a Gotify server.
+type GotifyConfig struct {
+	Server string `yaml:"server"`
+	// Token of the application.
+	Token string `yaml:"token"`
+	// Priority of the messages, 8 if not set. Gotify clients alert from 8 on by default.
+	Priority  int             `yaml:"priority"`
+	Template  MessageTemplate `yaml:"template"`
+	Selection `yaml:",inline"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Pool spreads the notifications over the notifiers of the backend with the same pool, see NotifierPool.
+	Pool string `yaml:"pool"`
+}
+
+// GotifyNotifier pushes notifications as messages of a Gotify application.
+type GotifyNotifier struct {
+	selector
+	config GotifyConfig
+	format messageFormat
+	client *http.Client
+}
+
+// NewGotifyNotifier validates the config and returns the notifier.
+func NewGotifyNotifier(c GotifyConfig) (*GotifyNotifier, error) {
+	if c.Server == "" || c.Token == "" {
+		return nil, fmt.Errorf("Gotify notifier needs server and token")
+	}
+	if c.Priority == 0 {
+		c.Priority = 8
+	}
+	sel, err := newSelector(c.Selection)
+	if err != nil {
+		return nil, err
+	}
+	format, err := newMessageFormat(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &GotifyNotifier{selector: sel, config: c, format: format, client: notifierHTTPClient("gotify")}, nil
+}
+
+func (g *GotifyNotifier) Name() string { return "gotify" }
+
+func (g *GotifyNotifier) Notify(ctx context.Context, n Notification) error {
+	return g.push(ctx, g.format.Title(n), g.format.Text(n), n.Link)
+}
+
+func (g *GotifyNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return g.push(ctx, title, text, "")
+}
+
+// push sends a message to the application, link is the optional URL opened by clicking it.
+func (g *GotifyNotifier) push(ctx context.Context, title, text, link string) error {
+	msg := map[string]interface{}{
+		"title":    title,
+		"message":  text,
+		"priority": g.config.Priority,
+	}
+	if link != "" {
+		msg["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": link}},
+		}
+	}
+	req, err := jsonRequest(ctx, strings.TrimSuffix(g.config.Server, "/")+"/message", msg)
+	if err != nil {
+		return err
+	}
+	// the header keeps the token out of logged URLs
+	req.Header.Set("X-Gotify-Key", g.config.Token)
+	return doRequest(g.client, req)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	notifyGroup       = flag.Bool("notify-group", true, "Combine the alerts a notifier gets at the same time into one message")
+	notifyGroupWindow = flag.Duration("notify-group-window", 0, "How long to collect further alerts for a combined message after the first (0 combines the alerts of a single poll only)")
+)
+
+// Grouper collects the alerts of each notifier during the group window and sends them as one message.
+type Grouper struct {
+	mu sync.Mutex
+	// pending are the alerts of the notifiers with an open window
+	pending map[Notifier][]Notification
+}
+
+var grouper = &Grouper{pending: map[Notifier][]Notification{}}
+
+// Add sends the alerts of a poll to the notifier as one message. With a group window the
+// first call waits for the window to pass and includes the alerts added meanwhile, later
+// calls within the window return immediately.
+func (g *Grouper) Add(ctx context.Context, notifier Notifier, alerts []Notification) {
+	if *notifyGroupWindow > 0 {
+		if alerts = g.collect(ctx, notifier, alerts, *notifyGroupWindow); alerts == nil {
+			return
+		}
+	}
+	deliver(ctx, notifier, Group(alerts))
+}
+
+// Batch sends the notifications to a BatchNotifier as one notification whose Group holds
+// all notifications added during the window, including several of the same series.
+func (g *Grouper) Batch(ctx context.Context, notifier Notifier, notifications []Notification, window time.Duration) {
+	batch := g.collect(ctx, notifier, notifications, window)
+	if batch == nil {
+		return
+	}
+	notifyStats.ObserveBatch(notifier.Name(), len(batch))
+	n := batch[0]
+	n.Group = batch
+	deliver(ctx, notifier, n)
+}
+
+// collect returns the notifications added for the notifier during the window. Only the
+// first call of a window waits for it to pass, later calls within it return nil.
+func (g *Grouper) collect(ctx context.Context, notifier Notifier, notifications []Notification, window time.Duration) []Notification {
+	g.mu.Lock()
+	if pending, open := g.pending[notifier]; open {
+		g.pending[notifier] = append(pending, notifications...)
+		g.mu.Unlock()
+		return nil
+	}
+	g.pending[notifier] = notifications
+	g.mu.Unlock()
+
+	select {
+	case <-clock.After(window):
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	notifications = g.pending[notifier]
+	delete(g.pending, notifier)
+	return notifications
+}
+
+// Group combines alerts into one notification listing them by the next slot, most slots first
+// on the same day. Alerts of a series seen several times during the window are taken the latest.
+func Group(alerts []Notification) Notification {
+	latest := map[seriesKey]int{}
+	var members []Notification
+	for _, n := range alerts {
+		if i, ok := latest[n.Event.key()]; ok {
+			members[i] = n
+			continue
+		}
+		latest[n.Event.key()] = len(members)
+		members = append(members, n)
+	}
+	if len(members) == 1 {
+		return members[0]
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i].Event, members[j].Event
+		switch {
+		case a.NextSlot != b.NextSlot:
+			// the dates sort chronologically, unknown ones last
+			return b.NextSlot == "" || a.NextSlot != "" && a.NextSlot < b.NextSlot
+		case a.Slots != b.Slots:
+			return a.Slots > b.Slots
+		}
+		return a.Center < b.Center
+	})
+	n := members[0]
+	n.Group = members
+	return n
+}
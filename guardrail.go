@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var (
+	pollInterval       = flag.Duration("poll-interval", time.Minute, "Interval for polling the availabilities in the background")
+	maxRequestsPerHour = flag.Float64("max-requests-per-hour", 3600, "Safety ceiling for the estimated upstream request rate (0 disables)")
+	clampRequests      = flag.Bool("clamp-requests", false, "Clamp the availability requests per poll to the ceiling instead of refusing to start")
+)
+
+// maxRequestsPerPoll limits the availability requests per poll when clamping, 0 means no limit.
+var maxRequestsPerPoll int
+
+// PlannedRequests returns the upstream requests per poll: one per booking page and one per
+// enabled motive and practice offering it.
+func PlannedRequests(centers []doctolib.Impfzentrum) int {
+	requests := len(BookingPages())
+	for _, c := range centers {
+		requests += centerRequests(c)
+	}
+	return requests
+}
+
+// centerRequests returns the availability requests per poll of a center.
+func centerRequests(c doctolib.Impfzentrum) int {
+	requests := 0
+	for id := range c.Vaccination {
+		requests += len(c.Practices(id)) * len(InsuranceSectors())
+	}
+	return requests
+}
+
+// RequestsPerHour estimates the hourly request rate for the given requests per poll every interval.
+func RequestsPerHour(requests int, interval time.Duration) float64 {
+	return float64(requests) * float64(time.Hour) / float64(interval)
+}
+
+// PlannedRequestRate estimates the hourly request rate of polling the centers every interval,
+// or at the poll interval of their overrides. The booking pages are fetched on every poll,
+// i.e. at the shortest interval.
+func PlannedRequestRate(centers []doctolib.Impfzentrum, interval time.Duration) float64 {
+	rate := RequestsPerHour(len(BookingPages()), overrides.Tick(interval))
+	for _, c := range centers {
+		rate += RequestsPerHour(centerRequests(c), overrides.Interval(c, interval))
+	}
+	return rate
+}
+
+// CheckRequestRate compares the estimated request rate of the monitoring plan polled every
+// interval against the ceiling. It fails if the ceiling is exceeded, unless clamping is enabled.
+// Every command polling repeatedly must call it with its interval.
+func CheckRequestRate(ctx context.Context, interval time.Duration) error {
+	if *maxRequestsPerHour <= 0 {
+		return nil
+	}
+	centers, err := Plan(ctx)
+	if err != nil {
+		log.Printf("Failed to check the estimated request rate: %s", err)
+		return nil
+	}
+	centers = cluster.Partition(centers)
+	requests := PlannedRequests(centers)
+	if burst.Interval < interval {
+		if burstRate := RequestsPerHour(requests, burst.Interval); burstRate > *maxRequestsPerHour {
+			log.Printf("WARNING: Estimated request rate of %.0f requests/hour in burst mode exceeds the ceiling of %.0f, only sending %d of %d availability requests per poll while it is active",
+				burstRate, *maxRequestsPerHour, RequestBudget(burst.Interval, len(BookingPages())), requests-len(BookingPages()))
+		}
+	}
+	rate := PlannedRequestRate(centers, interval)
+	if rate <= *maxRequestsPerHour {
+		return nil
+	}
+	if !*clampRequests {
+		return fmt.Errorf("Estimated request rate of %.0f requests/hour (%d per poll every %s) exceeds the ceiling of %.0f, refusing to start", rate, requests, interval, *maxRequestsPerHour)
+	}
+	allowed := allowedRequests(overrides.Tick(interval), len(BookingPages()))
+	maxRequestsPerPoll = allowed
+	log.Printf("WARNING: Estimated request rate of %.0f requests/hour exceeds the ceiling of %.0f, only sending %d of %d availability requests per poll", rate, *maxRequestsPerHour, allowed, requests-len(BookingPages()))
+	return nil
+}
+
+// allowedRequests returns the availability requests per poll at interval within the ceiling,
+// pages is the number of booking page requests per poll.
+func allowedRequests(interval time.Duration, pages int) int {
+	allowed := int(*maxRequestsPerHour*float64(interval)/float64(time.Hour)) - pages
+	if allowed < 1 {
+		allowed = 1
+	}
+	return allowed
+}
+
+// RequestBudget returns the availability requests allowed in a poll after interval, 0 means
+// no limit. Polls more often than the poll interval, i.e. in burst mode, are always clamped
+// to the ceiling whereas regular polls only with --clamp-requests.
+func RequestBudget(interval time.Duration, pages int) int {
+	if *maxRequestsPerHour <= 0 || interval >= *pollInterval {
+		return maxRequestsPerPoll
+	}
+	allowed := allowedRequests(interval, pages)
+	if maxRequestsPerPoll > 0 && maxRequestsPerPoll < allowed {
+		return maxRequestsPerPoll
+	}
+	return allowed
+}
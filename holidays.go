@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var holidayState = flag.String("holiday-state", "BE", "German state (BW, BY, BE, BB, HB, HH, HE, MV, NI, NW, RP, SL, SN, ST, SH, TH) whose public holidays are no business days")
+
+// holiday is a public holiday, either on a fixed date or relative to easter sunday.
+type holiday struct {
+	month, day   int
+	easterOffset int
+	states       string
+}
+
+// germanHolidays lists the public holidays in Germany, states is empty for nationwide holidays.
+var germanHolidays = []holiday{
+	{month: 1, day: 1},                                         // Neujahr
+	{month: 1, day: 6, states: "BW BY ST"},                     // Heilige Drei Koenige
+	{month: 3, day: 8, states: "BE MV"},                        // Internationaler Frauentag
+	{easterOffset: -2},                                         // Karfreitag
+	{easterOffset: 1},                                          // Ostermontag
+	{month: 5, day: 1},                                         // Tag der Arbeit
+	{easterOffset: 39},                                         // Christi Himmelfahrt
+	{easterOffset: 50},                                         // Pfingstmontag
+	{easterOffset: 60, states: "BW BY HE NW RP SL"},            // Fronleichnam
+	{month: 8, day: 15, states: "SL"},                          // Mariae Himmelfahrt
+	{month: 9, day: 20, states: "TH"},                          // Weltkindertag
+	{month: 10, day: 3},                                        // Tag der Deutschen Einheit
+	{month: 10, day: 31, states: "BB HB HH MV NI SN ST SH TH"}, // Reformationstag
+	{month: 11, day: 1, states: "BW BY NW RP SL"},              // Allerheiligen
+	{month: 12, day: 25},                                       // 1. Weihnachtstag
+	{month: 12, day: 26},                                       // 2. Weihnachtstag
+}
+
+const germanStates = "BW BY BE BB HB HH HE MV NI NW RP SL SN ST SH TH"
+
+// ValidateHolidayState checks that state is a known German state.
+func ValidateHolidayState(state string) error {
+	for _, s := range strings.Fields(germanStates) {
+		if s == state {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown German state %q", state)
+}
+
+// easterSunday computes the date of easter sunday (anonymous Gregorian algorithm).
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := (19*a + b - b/4 - (b-(b+8)/25+1)/3 + 15) % 30
+	e := (32 + 2*(b%4) + 2*(c/4) - d - c%4) % 7
+	f := d + e - 7*((a+11*d+22*e)/451) + 114
+	return time.Date(year, time.Month(f/31), f%31+1, 0, 0, 0, 0, time.UTC)
+}
+
+// IsHoliday reports whether the date is a public holiday in the given state.
+func IsHoliday(state string, date time.Time) bool {
+	year, month, day := date.Date()
+	easter := easterSunday(year)
+	for _, h := range germanHolidays {
+		if h.states != "" && !strings.Contains(" "+h.states+" ", " "+state+" ") {
+			continue
+		}
+		if h.month == 0 {
+			d := easter.AddDate(0, 0, h.easterOffset)
+			if d.Month() == month && d.Day() == day {
+				return true
+			}
+		} else if time.Month(h.month) == month && h.day == day {
+			return true
+		}
+	}
+	// Buss- und Bettag is the Wednesday before November 23rd.
+	if state == "SN" && month == time.November && date.Weekday() == time.Wednesday && day >= 16 && day <= 22 {
+		return true
+	}
+	return false
+}
+
+// IsBusinessDay reports whether the date is neither a weekend nor a public holiday in the given state.
+func IsBusinessDay(state string, date time.Time) bool {
+	if wd := date.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return !IsHoliday(state, date)
+}
+
+// Day returns the calendar date of t in the configured time zone as midnight UTC.
+func Day(t time.Time) time.Time {
+	y, m, d := t.In(location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// CalendarDays returns the number of calendar days from one date to another.
+func CalendarDays(from, to time.Time) int {
+	return int(Day(to).Sub(Day(from)).Hours() / 24)
+}
+
+// BusinessDays returns the number of business days after from up to and including to.
+func BusinessDays(state string, from, to time.Time) int {
+	days := 0
+	for d := Day(from).AddDate(0, 0, 1); !d.After(Day(to)); d = d.AddDate(0, 0, 1) {
+		if IsBusinessDay(state, d) {
+			days++
+		}
+	}
+	return days
+}
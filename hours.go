@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// IsOpen reports whether a place with the given opening hours is open at t.
+// The second return value is false if no opening hours are known.
+func IsOpen(hours []doctolib.OpeningHours, t time.Time) (bool, bool) {
+	if len(hours) == 0 {
+		return false, false
+	}
+	t = t.In(location)
+	now := t.Format("15:04")
+	for _, h := range hours {
+		if !h.Enabled || time.Weekday(h.Day%7) != t.Weekday() {
+			continue
+		}
+		for _, r := range h.Ranges {
+			if r[0] <= now && now < r[1] {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// InsuranceSectors returns the configured insurance sectors.
+func InsuranceSectors() []string {
+	var sectors []string
+	for _, s := range strings.Split(*insuranceSector, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sectors = append(sectors, s)
+		}
+	}
+	return sectors
+}
+
+// ValidateInsuranceSectors checks the configured insurance sectors.
+func ValidateInsuranceSectors() error {
+	sectors := InsuranceSectors()
+	if len(sectors) == 0 {
+		return fmt.Errorf("At least one insurance sector is needed")
+	}
+	seen := map[string]bool{}
+	for _, s := range sectors {
+		if s != "public" && s != "private" {
+			return fmt.Errorf("Unknown insurance sector %q", s)
+		}
+		if seen[s] {
+			return fmt.Errorf("Duplicate insurance sector %q", s)
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
+type insuranceKey struct{}
+
+// WithInsuranceSector returns a context querying the availabilities for the given sector.
+func WithInsuranceSector(ctx context.Context, sector string) context.Context {
+	return context.WithValue(ctx, insuranceKey{}, sector)
+}
+
+// InsuranceSector returns the sector to query for in ctx, the first configured one by default.
+func InsuranceSector(ctx context.Context) string {
+	if s, ok := ctx.Value(insuranceKey{}).(string); ok {
+		return s
+	}
+	return InsuranceSectors()[0]
+}
+
+// practiceKey identifies the availabilities of a motive at a practice for an insurance sector.
+type practiceKey struct {
+	practice, motive int
+	insurance        string
+}
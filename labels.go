@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	externalLabelsFlag = flag.String("external-labels", "", "Comma separated key=value labels added to all exported series, e.g. city=berlin,operator=ops1")
+	labelTransliterate = flag.Bool("label-transliterate", false, "Transliterate umlauts and accents in center and motive label values to ASCII")
+	labelSlug          = flag.Bool("label-slug", false, "Export center and motive label values as lowercase slugs, implies --label-transliterate")
+	labelMaxLength     = flag.Int("label-max-length", 0, "Truncate center and motive label values to this many characters, suffixed by a hash to stay unique (0 disables)")
+)
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelNames are the label names of the exported series besides motiveLabelNames.
+var reservedLabelNames = []string{"alias", "booking_page", "changed", "disabled", "doses", "egress", "instance_name", "insurance", "min_interval_days", "motive_id",
+	"full_name", "label", "notifier", "platform", "product", "profile", "region", "result", "shard", "suppressed", "vaccine", "value", "instance", "job"}
+
+// externalLabels are added to all exported series.
+var externalLabels prometheus.Labels
+
+// ParseExternalLabels parses a comma separated list of key=value pairs.
+func ParseExternalLabels(s string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !labelNamePattern.MatchString(kv[0]) || strings.HasPrefix(kv[0], "__") {
+			return nil, fmt.Errorf("Invalid external label %q, expected key=value", pair)
+		}
+		if _, ok := labels[kv[0]]; ok {
+			return nil, fmt.Errorf("Duplicate external label %q", kv[0])
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// SetupExternalLabels parses the external labels. It must be called after all label
+// names of the exported series are known and before the registry is set up.
+func SetupExternalLabels() error {
+	labels, err := ParseExternalLabels(*externalLabelsFlag)
+	if err != nil {
+		return err
+	}
+	for name := range labels {
+		for _, l := range append(motiveLabelNames[:len(motiveLabelNames):len(motiveLabelNames)], reservedLabelNames...) {
+			if name == l {
+				return fmt.Errorf("External label %q collides with a label of the exported series", name)
+			}
+		}
+	}
+	externalLabels = labels
+	return nil
+}
+
+// transliterations map the characters of center and motive names which are not ASCII.
+var transliterations = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue",
+	"á", "a", "à", "a", "â", "a", "é", "e", "è", "e", "ê", "e", "ë", "e", "í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ú", "u", "ù", "u", "û", "u", "ç", "c", "ñ", "n",
+	"É", "E", "È", "E", "Ç", "C", "–", "-", "—", "-", "„", "\"", "“", "\"", "”", "\"", "’", "'",
+)
+
+// NormalizeLabelValue applies the label normalization flags to a center or motive name.
+// Characters left which are not ASCII are dropped once transliterated.
+func NormalizeLabelValue(s string) string {
+	v := s
+	if *labelTransliterate || *labelSlug {
+		v = strings.Map(func(r rune) rune {
+			if r >= utf8.RuneSelf {
+				return -1
+			}
+			return r
+		}, transliterations.Replace(v))
+	}
+	if *labelSlug {
+		v = slugify(v)
+	}
+	if *labelMaxLength > 0 && utf8.RuneCountInString(v) > *labelMaxLength {
+		v = truncateLabelValue(v, s, *labelMaxLength)
+	}
+	return v
+}
+
+// slugify lowercases s and replaces every run of characters other than letters and digits by a dash.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// minLabelMaxLength leaves room for a few characters besides the hash suffix of truncated values.
+const minLabelMaxLength = 12
+
+// truncateLabelValue shortens v to max characters. It cuts at a word boundary if one is near
+// and appends a hash of the full name, so distinct names sharing a prefix stay distinct series.
+func truncateLabelValue(v, full string, max int) string {
+	h := fnv.New32a()
+	h.Write([]byte(full))
+	suffix := fmt.Sprintf("~%04x", h.Sum32()&0xffff)
+	runes := []rune(v)[:max-len(suffix)]
+	for i := len(runes) - 1; i >= len(runes)*2/3; i-- {
+		if runes[i] == ' ' || runes[i] == '-' || runes[i] == '/' {
+			runes = runes[:i]
+			break
+		}
+	}
+	return strings.TrimRight(string(runes), " -/_,.") + suffix
+}
+
+// normalizingLabels reports whether label values differ from the names, so the mapping is exported.
+func normalizingLabels() bool {
+	return *labelTransliterate || *labelSlug || *labelMaxLength > 0
+}
+
+// ValidateLabelNormalization checks the label normalization flags.
+func ValidateLabelNormalization() error {
+	if *labelMaxLength != 0 && *labelMaxLength < minLabelMaxLength {
+		return fmt.Errorf("Label max length must be 0 or at least %d, got %d", minLabelMaxLength, *labelMaxLength)
+	}
+	return nil
+}
+
+// labelValueMapping maps a normalized label value to the full name.
+type labelValueMapping struct {
+	label, value, full string
+}
+
+// LabelValueMappings returns the normalized center and motive names of centers which
+// differ from the full names, for joining the full names onto the series.
+func LabelValueMappings(centers []doctolib.Impfzentrum) []labelValueMapping {
+	seen := map[labelValueMapping]bool{}
+	add := func(label, full string) {
+		if v := NormalizeLabelValue(full); v != full {
+			seen[labelValueMapping{label, v, full}] = true
+		}
+	}
+	for _, center := range centers {
+		add("name", center.Name)
+		for _, motive := range center.Vaccination {
+			add("type", motive)
+		}
+		for _, motive := range center.DisabledVaccination {
+			add("type", motive)
+		}
+	}
+	mappings := make([]labelValueMapping, 0, len(seen))
+	for m := range seen {
+		mappings = append(mappings, m)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].label != mappings[j].label {
+			return mappings[i].label < mappings[j].label
+		}
+		return mappings[i].value < mappings[j].value
+	})
+	return mappings
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	centerRetention = flag.Int("center-retention-polls", 3, "Polls a center may be missing from its booking page, exporting its last availabilities, before its series and state are dropped")
+	centerStateFile = flag.String("center-state-file", "", "JSON file persisting the names and previous names of the centers across restarts")
+)
+
+// CenterRecord is the identity of a center with its name history.
+type CenterRecord struct {
+	BookingPage string        `json:"booking_page"`
+	PracticeID  int           `json:"practice_id"`
+	Name        string        `json:"name"`
+	Aliases     []CenterAlias `json:"aliases,omitempty"`
+}
+
+// CenterAlias is a previous name of a center.
+type CenterAlias struct {
+	Name string `json:"name"`
+	// Until is the time of the poll which first saw the next name.
+	Until time.Time `json:"until"`
+}
+
+// CenterRenamedEvent reports that a center got a new name upstream.
+type CenterRenamedEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	BookingPage   string    `json:"booking_page"`
+	PracticeID    int       `json:"practice_id"`
+	Center        string    `json:"center"`
+	Previous      string    `json:"previous"`
+	Cycle         string    `json:"cycle,omitempty"`
+}
+
+// CenterLifecycle tracks the centers by practice ID. It records their renames, bridges
+// centers missing from a few polls, e.g. while their booking page fails, and retires
+// centers missing for longer: their series are no longer exported, their state is
+// dropped and notifiers selecting them explicitly are told.
+type CenterLifecycle struct {
+	mu sync.Mutex
+	// consecutive polls each center of the exported snapshot was missing
+	missing map[centerKey]int
+	retired uint64
+	records map[centerKey]*CenterRecord
+
+	missingDesc *prometheus.Desc
+	retiredDesc *prometheus.Desc
+	aliasDesc   *prometheus.Desc
+}
+
+var lifecycle = &CenterLifecycle{missing: map[centerKey]int{}, records: map[centerKey]*CenterRecord{}}
+
+// Load reads the persisted center records, a missing file is no error.
+func (l *CenterLifecycle) Load(file string) error {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Reading center state failed: %s", err)
+	}
+	var records []*CenterRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("Failed to parse center state %s: %s", file, err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range records {
+		l.records[centerKey{r.BookingPage, r.PracticeID}] = r
+	}
+	return nil
+}
+
+// save persists the center records, l.mu must be held.
+func (l *CenterLifecycle) save(file string) error {
+	if file == "" {
+		return nil
+	}
+	records := make([]*CenterRecord, 0, len(l.records))
+	for _, r := range l.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].BookingPage != records[j].BookingPage {
+			return records[i].BookingPage < records[j].BookingPage
+		}
+		return records[i].PracticeID < records[j].PracticeID
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Aliases returns the previous names of a center, oldest first.
+func (l *CenterLifecycle) Aliases(key centerKey) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.records[key]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, a := range r.Aliases {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+// track records the current name of a center and reports a rename, l.mu must be held.
+func (l *CenterLifecycle) track(c doctolib.Impfzentrum, now time.Time) (renamed *CenterRenamedEvent, changed bool) {
+	key := keyOfCenter(c)
+	r, ok := l.records[key]
+	if !ok {
+		l.records[key] = &CenterRecord{BookingPage: c.BookingPage, PracticeID: c.ID, Name: c.Name}
+		return nil, true
+	}
+	if r.Name == c.Name {
+		return nil, false
+	}
+	log.Printf("Center %d of %s was renamed from %q to %q", c.ID, c.BookingPage, r.Name, c.Name)
+	renamed = &CenterRenamedEvent{SchemaVersion: EventSchemaVersion, Time: now, BookingPage: c.BookingPage, PracticeID: c.ID, Center: c.Name, Previous: r.Name}
+	// a center switching back and forth keeps one alias per name
+	aliases := r.Aliases[:0]
+	for _, a := range r.Aliases {
+		if a.Name != r.Name && a.Name != c.Name {
+			aliases = append(aliases, a)
+		}
+	}
+	r.Aliases = append(aliases, CenterAlias{Name: r.Name, Until: now})
+	r.Name = c.Name
+	return renamed, true
+}
+
+// Reconcile carries the centers of prev missing from snap over into snap together with their
+// last observations until they were missing for --center-retention-polls, then retires them.
+// Centers which moved to another shard are dropped at once.
+func (l *CenterLifecycle) Reconcile(ctx context.Context, prev, snap *Snapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	present := map[centerKey]bool{}
+	dirty := false
+	defer func() {
+		if !dirty {
+			return
+		}
+		if err := l.save(*centerStateFile); err != nil {
+			log.Printf("Failed to save center state: %s", err)
+		}
+	}()
+	var renames []StreamEvent
+	for _, c := range snap.Centers {
+		present[keyOfCenter(c)] = true
+		delete(l.missing, keyOfCenter(c))
+		renamed, changed := l.track(c, snap.Time)
+		dirty = dirty || changed
+		if renamed != nil {
+			renamed.Cycle = snap.Cycle
+			renames = append(renames, StreamEvent{StreamCenterRenamed, *renamed})
+		}
+	}
+	stream.Publish(renames)
+	if prev == nil {
+		return
+	}
+	carried := map[centerKey]bool{}
+	for _, c := range prev.Centers {
+		key := keyOfCenter(c)
+		if present[key] {
+			continue
+		}
+		if len(cluster.Partition([]doctolib.Impfzentrum{c})) == 0 {
+			delete(l.missing, key)
+			delete(l.records, key)
+			dirty = true
+			forgetCenter(c)
+			continue
+		}
+		l.missing[key]++
+		if l.missing[key] <= *centerRetention {
+			carried[key] = true
+			snap.Centers = append(snap.Centers, c)
+			continue
+		}
+		delete(l.missing, key)
+		// a center offered again later starts without its previous names
+		delete(l.records, key)
+		dirty = true
+		l.retired++
+		reason := "no longer offered"
+		if !snap.fetched[c.BookingPage] {
+			reason = "booking page unavailable"
+		}
+		log.Printf("Retiring center %s of %s missing for %d polls: %s", c.Name, c.BookingPage, *centerRetention+1, reason)
+		forgetCenter(c)
+		// a failing booking page is no news for the subscribers
+		if snap.fetched[c.BookingPage] {
+			go NotifyRetired(ctx, c)
+		}
+	}
+	if len(carried) == 0 {
+		return
+	}
+	for _, o := range prev.Observations {
+		if carried[keyOfCenter(o.Center)] {
+			snap.Observations = append(snap.Observations, o)
+		}
+	}
+	snap.hash = snap.Hash()
+}
+
+// forgetCenter drops the state kept about a center.
+func forgetCenter(c doctolib.Impfzentrum) {
+	dedup.Forget(keyOfCenter(c))
+	scrapeStats.Forget(c.BookingPage, c.ID)
+	for practice := range c.PracticeAgendas {
+		adaptive.Forget(practice)
+	}
+	adaptive.Forget(c.ID)
+}
+
+// NotifyRetired tells the notifiers selecting a center by ID or name that it is no longer offered.
+func NotifyRetired(ctx context.Context, c doctolib.Impfzentrum) {
+	var targets []Notifier
+	for _, n := range notifiers {
+		if s, ok := n.(interface{ SelectsCenter(int, string) bool }); ok && s.SelectsCenter(c.ID, c.Name) {
+			targets = append(targets, n)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	Broadcast(ctx, targets, "Impfzentrum nicht mehr verfuegbar",
+		fmt.Sprintf("%s wird auf Doctolib nicht mehr angeboten, es gibt keine Benachrichtigungen mehr dafuer.\n%s", c.Name, BookingLink(c.BookingPage)))
+}
+
+func (l *CenterLifecycle) Describe(ch chan<- *prometheus.Desc) {
+	if l.missingDesc == nil {
+		l.missingDesc = prometheus.NewDesc("impfe_centers_missing",
+			"Impfzentren, die bei der letzten Abfrage fehlten und mit ihren letzten Werten exportiert werden",
+			nil, nil,
+		)
+		l.retiredDesc = prometheus.NewDesc("impfe_centers_retired_total",
+			"Impfzentren, die zu lange fehlten und nicht mehr exportiert werden",
+			nil, nil,
+		)
+		l.aliasDesc = prometheus.NewDesc("impfe_center_alias_info",
+			"Fruehere Namen der Impfzentren",
+			[]string{"booking_page", "id", "name", "alias"}, nil,
+		)
+	}
+	ch <- l.missingDesc
+	ch <- l.retiredDesc
+	ch <- l.aliasDesc
+}
+
+func (l *CenterLifecycle) Collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(l.missingDesc, prometheus.GaugeValue, float64(len(l.missing)))
+	ch <- prometheus.MustNewConstMetric(l.retiredDesc, prometheus.CounterValue, float64(l.retired))
+	for _, r := range l.records {
+		name := NormalizeLabelValue(r.Name)
+		// names may only differ in what normalization drops, and older state files may repeat them
+		seen := map[string]bool{name: true}
+		for _, a := range r.Aliases {
+			alias := NormalizeLabelValue(a.Name)
+			if seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			ch <- prometheus.MustNewConstMetric(l.aliasDesc, prometheus.GaugeValue, 1, r.BookingPage, strconv.Itoa(r.PracticeID), name, alias)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// aliasLabels returns the name and alias labels of the impfe_center_alias_info samples.
+func aliasLabels(t *testing.T, l *CenterLifecycle) [][2]string {
+	t.Helper()
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(l); err != nil {
+		t.Fatal(err)
+	}
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	var aliases [][2]string
+	for _, f := range families {
+		if f.GetName() != "impfe_center_alias_info" {
+			continue
+		}
+		for _, m := range f.Metric {
+			aliases = append(aliases, [2]string{labelValue(m, "name"), labelValue(m, "alias")})
+		}
+	}
+	return aliases
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestCenterRenamedBackAndForth(t *testing.T) {
+	l := &CenterLifecycle{missing: map[centerKey]int{}, records: map[centerKey]*CenterRecord{}}
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	for i, name := range []string{"Arena", "Velodrom", "Arena", "Velodrom"} {
+		c := doctolib.Impfzentrum{ID: 1, Name: name, BookingPage: "ciz-berlin-berlin"}
+		l.Reconcile(context.Background(), nil, &Snapshot{Time: now.Add(time.Duration(i) * time.Minute), Centers: []doctolib.Impfzentrum{c}})
+	}
+
+	aliases := aliasLabels(t, l)
+	if len(aliases) != 1 || aliases[0] != [2]string{"Velodrom", "Arena"} {
+		t.Errorf("alias series = %v, want [[Velodrom Arena]]", aliases)
+	}
+	if got := l.Aliases(centerKey{"ciz-berlin-berlin", 1}); len(got) != 1 || got[0] != "Arena" {
+		t.Errorf("Aliases() = %v, want [Arena]", got)
+	}
+
+	// state files written before aliases were deduplicated
+	l.records[centerKey{"ciz-berlin-berlin", 1}].Aliases = []CenterAlias{{Name: "Arena"}, {Name: "Velodrom"}, {Name: "Arena"}}
+	if aliases := aliasLabels(t, l); len(aliases) != 1 {
+		t.Errorf("alias series of a repeated alias = %v, want one", aliases)
+	}
+}
+
+func TestRetiredCenterForgetsAliases(t *testing.T) {
+	l := &CenterLifecycle{missing: map[centerKey]int{}, records: map[centerKey]*CenterRecord{}}
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	var prev *Snapshot
+	for i, name := range []string{"Arena", "Velodrom"} {
+		c := doctolib.Impfzentrum{ID: 1, Name: name, BookingPage: "ciz-berlin-berlin"}
+		snap := &Snapshot{Time: now.Add(time.Duration(i) * time.Minute), Centers: []doctolib.Impfzentrum{c}}
+		l.Reconcile(context.Background(), prev, snap)
+		prev = snap
+	}
+	for i := 0; i <= *centerRetention; i++ {
+		snap := &Snapshot{Time: now.Add(time.Duration(i+2) * time.Minute)}
+		l.Reconcile(context.Background(), prev, snap)
+		prev = snap
+	}
+	if aliases := aliasLabels(t, l); len(aliases) != 0 {
+		t.Errorf("alias series of a retired center = %v, want none", aliases)
+	}
+	if len(l.records) != 0 {
+		t.Errorf("records of a retired center = %v, want none", l.records)
+	}
+}
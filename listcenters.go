@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ListedCenter is a place of a booking page as printed by list-centers.
+type ListedCenter struct {
+	BookingPage string `json:"booking_page"`
+	Name        string `json:"name"`
+	PracticeID  int    `json:"practice_id"`
+	Zipcode     string `json:"zipcode,omitempty"`
+	City        string `json:"city,omitempty"`
+	// Practices holds the agenda IDs per practice ID of the place.
+	Practices map[int][]int  `json:"practices"`
+	Motives   []ListedMotive `json:"motives"`
+}
+
+// ListedMotive is a visit motive of a place.
+type ListedMotive struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Vaccine  string `json:"vaccine,omitempty"`
+	Channel  string `json:"channel"`
+	Disabled bool   `json:"disabled"`
+	// Practices offering the motive.
+	Practices []int `json:"practice_ids"`
+}
+
+// ListCenters fetches the booking pages and returns all their places and motives, ignoring all filters.
+func ListCenters(ctx context.Context, pages []string) ([]ListedCenter, error) {
+	var result []ListedCenter
+	for _, page := range pages {
+		centers, err := source.Impfzentren(ctx, page)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch booking page %s: %s", page, err)
+		}
+		for _, c := range centers {
+			lc := ListedCenter{BookingPage: c.BookingPage, Name: c.Name, PracticeID: c.ID, Zipcode: c.Zipcode, City: c.City, Practices: c.PracticeAgendas}
+			if len(lc.Practices) == 0 {
+				lc.Practices = map[int][]int{c.ID: c.AgendaIDs}
+			}
+			for disabled, motives := range map[bool]map[int]string{false: c.Vaccination, true: c.DisabledVaccination} {
+				for id, name := range motives {
+					m := ListedMotive{ID: id, Name: name, Vaccine: VaccineLabel(name), Channel: c.Channel(id), Disabled: disabled, Practices: c.Practices(id)}
+					lc.Motives = append(lc.Motives, m)
+				}
+			}
+			sort.Slice(lc.Motives, func(i, j int) bool { return lc.Motives[i].ID < lc.Motives[j].ID })
+			result = append(result, lc)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].BookingPage != result[j].BookingPage {
+			return result[i].BookingPage < result[j].BookingPage
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// RunListCenters prints the places, practices, agendas and motives of the booking pages
+// as a table or JSON, to look up the IDs for the filter configuration.
+func RunListCenters(ctx context.Context, w io.Writer, pages []string, output string) error {
+	if output != OutputTable && output != OutputJSON {
+		return fmt.Errorf("Unknown output format %q", output)
+	}
+	centers, err := ListCenters(ctx, pages)
+	if err != nil {
+		return err
+	}
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(centers)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PAGE\tCENTER\tPRACTICES\tAGENDAS\tMOTIVE\tNAME\tCHANNEL\tDISABLED")
+	for _, c := range centers {
+		for _, m := range c.Motives {
+			var practices, agendas []string
+			for _, p := range m.Practices {
+				practices = append(practices, fmt.Sprint(p))
+				for _, a := range c.Practices[p] {
+					agendas = append(agendas, fmt.Sprint(a))
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%t\n", c.BookingPage, c.Name, strings.Join(practices, ","), strings.Join(agendas, ","), m.ID, m.Name, m.Channel, m.Disabled)
+		}
+	}
+	return tw.Flush()
+}
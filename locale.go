@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+var (
+	timezone = flag.String("timezone", "", "Time zone for day calculations and dates, e.g. Europe/Berlin (default: host time zone, Europe/Berlin if the host uses UTC)")
+	locale   = flag.String("locale", "", "Locale for rendering dates, e.g. de_DE (default: from LC_ALL, LC_TIME or LANG)")
+)
+
+// location is the time zone used for day calculations, opening hours and rendering dates.
+var location = time.Local
+
+// dateFormats are the date layouts per language or language_TERRITORY.
+var dateFormats = map[string]string{
+	"de":    "02.01.2006",
+	"en":    "2006-01-02",
+	"en_US": "01/02/2006",
+	"en_GB": "02/01/2006",
+	"fr":    "02/01/2006",
+	"it":    "02/01/2006",
+}
+
+// SetupLocale resolves the time zone and locale from the flags or the host.
+func SetupLocale() error {
+	switch {
+	case *timezone != "":
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("Failed to load time zone %s: %s", *timezone, err)
+		}
+		location = loc
+	case time.Local.String() == "UTC" || time.Local.String() == "Local" && isUTC(time.Local):
+		// Containers usually run in UTC while the centers are German.
+		location, _ = time.LoadLocation("Europe/Berlin")
+	default:
+		location = time.Local
+	}
+
+	if *locale == "" {
+		for _, env := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+			if v := os.Getenv(env); v != "" && v != "C" && v != "POSIX" {
+				*locale = v
+				break
+			}
+		}
+	}
+	// strip encoding and modifier, e.g. de_DE.UTF-8@euro
+	if i := strings.IndexAny(*locale, ".@"); i >= 0 {
+		*locale = (*locale)[:i]
+	}
+	return nil
+}
+
+func isUTC(loc *time.Location) bool {
+	_, offset := time.Now().In(loc).Zone()
+	return offset == 0
+}
+
+// FormatDate renders the date of t in the configured time zone and locale.
+func FormatDate(t time.Time) string {
+	layout, ok := dateFormats[*locale]
+	if !ok {
+		lang := *locale
+		if i := strings.Index(lang, "_"); i >= 0 {
+			lang = lang[:i]
+		}
+		if layout, ok = dateFormats[lang]; !ok {
+			layout = "2006-01-02"
+		}
+	}
+	return t.In(location).Format(layout)
+}
@@ -1,250 +1,482 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"math/rand"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
-	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"github.com/databus23/impfe/pkg/doctolib"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-type Availability struct {
-	Date  string `json:"date"`
-	Slots []Slot `json:"slots"`
-}
-type Slot struct {
-	Start    string `json:"start_date"`
-	End      string `json:"end_date"`
-	Steps    []Step `json:"steps"`
-	AgendaID int    `json:"agenda_id"`
-}
-type Step struct {
-	Start         string `json:"start_date"`
-	End           string `json:"end_date"`
-	VititMotiveID int    `json:"visit_motive_id"`
-	AgendaID      int    `json:"agenda_id"`
+type ImpfzentrenCollector struct {
+	impfzentrumMetric *prometheus.Desc
+	nextSlotMetric    *prometheus.Desc
+	leadTimeMetric    *prometheus.Desc
+	pausedMetric      *prometheus.Desc
+	openMetric        *prometheus.Desc
+	nextSlotDays      *prometheus.Desc
+	nextSlotBusDays   *prometheus.Desc
+	nextSlotSmoothed  *prometheus.Desc
+	monitoredCenters  *prometheus.Desc
+	monitoredMotives  *prometheus.Desc
+	monitoredSeries   *prometheus.Desc
+	plannedRequests   *prometheus.Desc
+	vaccineMetric     *prometheus.Desc
+	availableSlots    *prometheus.Desc
+	futureVacc        *prometheus.Desc
+	regionEarliest    *prometheus.Desc
+	nextSlotTimestamp *prometheus.Desc
+	labelValueInfo    *prometheus.Desc
+
+	// snapshot returns the snapshot to export, nil if there is none yet.
+	snapshot func() *Snapshot
 }
-type AvailbilitiesResponse struct {
-	Total                     int    `json:"total"`
-	Reason                    string `json:"reason"`
-	Message                   string `json:"message"`
-	NumberOfFutureVacinations int    `json:"number_future_vaccinations"`
-	NextSlot                  string `json:"next_slot"`
-	Availabilities            []Availability
+
+// motiveLabelNames are the labels of all series of a vaccination type at a center.
+// The raw motive name is the type label, vaccine and dose are normalized from it.
+var motiveLabelNames = []string{"name", "id", "type", "channel", "age_group", "booking_page", "vaccine", "dose"}
+
+// MotiveLabels returns the values of motiveLabelNames.
+func MotiveLabels(center doctolib.Impfzentrum, motiveID int, motiveName string) []string {
+	labels := []string{NormalizeLabelValue(center.Name), strconv.Itoa(center.ID), NormalizeLabelValue(motiveName), center.Channel(motiveID), ParseAgeGroup(motiveName).String(), center.BookingPage, VaccineLabel(motiveName), DoseLabel(motiveName)}
+	if len(config.Regions) > 0 {
+		labels = append(labels, Region(center))
+	}
+	if cluster.Enabled() {
+		labels = append(labels, ShardLabel())
+	}
+	return labels
 }
 
-type CIZRespone struct {
-	Data struct {
-		Places       []Place       `json:"places"`
-		Agendas      []Agenda      `json:"agendas"`
-		VisitMotives []VisitMotive `json:"visit_motives"`
-	} `json:"data"`
+// ObservationLabelNames are the labels of the series of an observation, extended by
+// the insurance sector if several are queried.
+func ObservationLabelNames() []string {
+	if len(InsuranceSectors()) > 1 {
+		return append(motiveLabelNames[:len(motiveLabelNames):len(motiveLabelNames)], "insurance")
+	}
+	return motiveLabelNames
 }
 
-type Place struct {
-	Name        string `json:"name"`
-	PractiseIDs []int  `json:"practice_ids"`
+// ObservationLabels returns the values of ObservationLabelNames.
+func ObservationLabels(o Observation) []string {
+	labels := MotiveLabels(o.Center, o.MotiveID, o.Motive)
+	if len(InsuranceSectors()) > 1 {
+		labels = append(labels, o.Insurance)
+	}
+	return labels
 }
 
-type Agenda struct {
-	ID                      int   `json:"id"`
-	VisitMotives            []int `json:"visit_motive_ids"`
-	PracticeID              int   `json:"practice_id"`
-	BookingDisabled         bool  `json:"booking_disabled"`
-	BookingTemporayDisabled bool  `json:"booking_temporary_disabled"`
+// seriesKey identifies the series of a center, vaccination type and insurance sector.
+type seriesKey struct {
+	center            centerKey
+	motive, insurance string
 }
 
-type VisitMotive struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+// centerKey identifies a center by its booking page and practice ID, in contrast to
+// its name it is not changed upstream.
+type centerKey struct {
+	bookingPage string
+	id          int
 }
 
-type Impfzentrum struct {
-	ID                  int
-	Name                string
-	DisabledVaccination map[int]string
-	Vaccination         map[int]string
-	AgendaIDs           []int
+func keyOfCenter(c doctolib.Impfzentrum) centerKey {
+	return centerKey{c.BookingPage, c.ID}
 }
 
-type ImpfzentrenCollector struct {
-	impfzentrumMetric *prometheus.Desc
-	nextSlotMetric    *prometheus.Desc
+var (
+	maxRequestSpacing = flag.Duration("max-request-spacing", 250*time.Millisecond, "Maximum random delay between two upstream availability requests")
+	workers           = flag.Int("workers", 4, "Number of availability requests in flight at the same time")
+	tlsFingerprint    = flag.String("tls-fingerprint", "", "Mimic the TLS fingerprint of a browser for upstream requests (chrome, firefox, safari, ios, edge)")
+	browserProfile    = flag.String("browser-profile", "", "Emulate the headers of a browser profile for upstream requests (e.g. chrome-desktop, firefox-mobile)")
+	browserProfiles   = flag.String("browser-profiles-file", "", "JSON file with additional browser profiles")
+	egress            = flag.String("egress", "", "Comma separated local IPs or proxy URLs to rotate upstream requests across, each optionally suffixed with *weight")
+	egressStrategy    = flag.String("egress-strategy", "round-robin", "How to rotate across egresses (round-robin, weighted)")
+	egressBanDuration = flag.Duration("egress-ban-duration", 30*time.Minute, "How long to avoid an egress after it got blocked")
+	listen            = flag.String("listen", ":2112", "Address to listen on for HTTP requests")
+	bookingPages      = flag.String("booking-pages", "ciz-berlin-berlin", "Comma separated slugs of the Doctolib booking pages to monitor")
+	lookahead         = flag.Int("lookahead", 4, "Number of days to look ahead for free slots")
+	insuranceSector   = flag.String("insurance-sector", "public", "Comma separated insurance sectors to query availabilities for (public, private)")
+	synthetic         = flag.Bool("synthetic", false, "Generate synthetic centers and availabilities instead of calling Doctolib")
+	smoothingAlpha    = flag.Float64("smoothing-alpha", 0, "Alpha of the exponential moving average exported as impfe_next_slot_days_smoothed (0 disables, 1 is no smoothing)")
+)
+
+var errorBudget = &ErrorBudget{}
+
+func init() {
+	flag.Float64Var(&errorBudget.MaxFraction, "pause-blocked-fraction", 0.5, "Pause polling if more than this fraction of upstream requests is blocked (0 disables)")
+	flag.DurationVar(&errorBudget.Window, "pause-window", 10*time.Minute, "Window for evaluating the fraction of blocked upstream requests")
+	flag.DurationVar(&errorBudget.Cooldown, "pause-cooldown", 30*time.Minute, "How long to pause polling once too many upstream requests were blocked")
 }
 
+// leadTimeBuckets are the upper bounds (in days) of the lead time histogram.
+var leadTimeBuckets = []float64{1, 2, 3, 5, 7, 14, 21, 28, 42, 56, 90}
+
 func (c *ImpfzentrenCollector) Describe(ch chan<- *prometheus.Desc) {
 	if c.impfzentrumMetric == nil {
+		labelNames := ObservationLabelNames()
 		c.impfzentrumMetric = prometheus.NewDesc("impfzentrum_info",
 			"Zeigt Impfzentren und Art der Impfung",
-			[]string{"name", "type", "disabled"}, nil,
+			append(motiveLabelNames[:len(motiveLabelNames):len(motiveLabelNames)], "disabled"), nil,
 		)
 		c.nextSlotMetric = prometheus.NewDesc("impfzentrum_next_free_timestamp",
 			"Naechster verfuegbarer Termin",
-			[]string{"name", "type"}, nil,
+			labelNames, nil,
+		)
+		c.leadTimeMetric = prometheus.NewDesc("impfe_lead_time_days",
+			"Verteilung der Tage bis zum naechsten Termin ueber alle Impfzentren und Impfungen",
+			nil, nil,
+		)
+		c.pausedMetric = prometheus.NewDesc("impfe_polling_paused",
+			"Abfragen pausiert, weil zu viele Anfragen blockiert wurden",
+			nil, nil,
+		)
+		c.openMetric = prometheus.NewDesc("impfe_center_open",
+			"Impfzentrum laut Oeffnungszeiten geoeffnet",
+			[]string{"name", "id", "booking_page"}, nil,
+		)
+		c.nextSlotTimestamp = prometheus.NewDesc("impfzentrum_next_slot_timestamp_seconds",
+			"Beginn des naechsten verfuegbaren Termins als Unix-Zeitstempel",
+			labelNames, nil,
+		)
+		c.nextSlotDays = prometheus.NewDesc("impfe_next_slot_days",
+			"Kalendertage bis zum naechsten verfuegbaren Termin",
+			labelNames, nil,
+		)
+		c.nextSlotBusDays = prometheus.NewDesc("impfe_next_slot_business_days",
+			"Werktage bis zum naechsten verfuegbaren Termin ohne Wochenenden und Feiertage",
+			labelNames, nil,
+		)
+		c.nextSlotSmoothed = prometheus.NewDesc("impfe_next_slot_days_smoothed",
+			"Geglaetteter gleitender Durchschnitt der Kalendertage bis zum naechsten Termin",
+			labelNames, nil,
+		)
+		c.monitoredCenters = prometheus.NewDesc("impfe_monitored_centers",
+			"Anzahl der ueberwachten Impfzentren",
+			nil, nil,
+		)
+		c.monitoredMotives = prometheus.NewDesc("impfe_monitored_motives",
+			"Anzahl der ueberwachten Impfungen",
+			nil, nil,
+		)
+		c.monitoredSeries = prometheus.NewDesc("impfe_monitored_series",
+			"Anzahl der abgefragten Kombinationen aus Impfzentrum und Impfung",
+			nil, nil,
+		)
+		c.vaccineMetric = prometheus.NewDesc("impfe_vaccine_info",
+			"Eigenschaften der Impfstoffe",
+			[]string{"vaccine", "product", "platform", "doses", "min_interval_days"}, nil,
+		)
+		c.availableSlots = prometheus.NewDesc("impfzentrum_available_slots",
+			"Freie Termine im Vorausschauzeitraum",
+			labelNames, nil,
+		)
+		c.futureVacc = prometheus.NewDesc("impfzentrum_future_vaccinations",
+			"Anzahl gebuchter zukuenftiger Impfungen laut Doctolib",
+			labelNames, nil,
+		)
+		c.regionEarliest = prometheus.NewDesc("impfe_region_earliest_slot_days",
+			"Kalendertage bis zum fruehesten Termin je Region und Impfstoff",
+			[]string{"region", "vaccine"}, nil,
+		)
+		c.plannedRequests = prometheus.NewDesc("impfe_planned_requests_per_cycle",
+			"Geplante Anfragen an Doctolib pro Abfrage",
+			nil, nil,
+		)
+		c.labelValueInfo = prometheus.NewDesc("impfe_label_value_info",
+			"Vollstaendiger Name zu einem normalisierten Label-Wert",
+			[]string{"label", "value", "full_name"}, nil,
 		)
 
 	}
 	ch <- c.impfzentrumMetric
+	ch <- c.nextSlotMetric
+	ch <- c.leadTimeMetric
+	ch <- c.pausedMetric
+	ch <- c.openMetric
+	ch <- c.nextSlotDays
+	ch <- c.nextSlotBusDays
+	ch <- c.nextSlotSmoothed
+	ch <- c.monitoredCenters
+	ch <- c.monitoredMotives
+	ch <- c.monitoredSeries
+	ch <- c.plannedRequests
+	ch <- c.vaccineMetric
+	ch <- c.availableSlots
+	ch <- c.futureVacc
+	ch <- c.regionEarliest
+	ch <- c.nextSlotTimestamp
+	ch <- c.labelValueInfo
 }
 
 func (cl *ImpfzentrenCollector) Collect(ch chan<- prometheus.Metric) {
 
-	centers, err := Impfzentren()
-	if err != nil {
-		log.Println("Error fetching impfzentren", err)
+	paused := 0.0
+	if errorBudget.Paused() {
+		paused = 1
+	}
+	ch <- prometheus.MustNewConstMetric(cl.pausedMetric, prometheus.GaugeValue, paused)
+	for _, v := range vaccines {
+		ch <- prometheus.MustNewConstMetric(cl.vaccineMetric, prometheus.GaugeValue, 1, v.ID, v.Product, v.Platform, strconv.Itoa(v.Doses), strconv.Itoa(v.MinIntervalDays))
+	}
+
+	snap := cl.snapshot()
+	if snap == nil {
 		return
 	}
+	snap = mutes.Suppress(snap)
+
+	total := 0
+	motives := map[int]bool{}
+	for _, center := range snap.Centers {
+		total += len(center.Vaccination)
+		for id := range center.Vaccination {
+			motives[id] = true
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(cl.monitoredCenters, prometheus.GaugeValue, float64(len(snap.Centers)))
+	ch <- prometheus.MustNewConstMetric(cl.monitoredMotives, prometheus.GaugeValue, float64(len(motives)))
+	ch <- prometheus.MustNewConstMetric(cl.monitoredSeries, prometheus.GaugeValue, float64(total))
+	ch <- prometheus.MustNewConstMetric(cl.plannedRequests, prometheus.GaugeValue, float64(snap.Planned))
+
+	if normalizingLabels() {
+		for _, m := range LabelValueMappings(snap.Centers) {
+			ch <- prometheus.MustNewConstMetric(cl.labelValueInfo, prometheus.GaugeValue, 1, m.label, m.value, m.full)
+		}
+	}
 
-	var wg sync.WaitGroup
-	for _, center := range centers {
+	for _, center := range snap.Centers {
+		if open, known := IsOpen(center.OpeningHours, snap.Time); known {
+			value := 0.0
+			if open {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(cl.openMetric, prometheus.GaugeValue, value, NormalizeLabelValue(center.Name), strconv.Itoa(center.ID), center.BookingPage)
+		}
 		for motiveID, motiveName := range center.Vaccination {
-			wg.Add(1)
-			go CollectAvailability(&wg, ch, cl.nextSlotMetric, center, motiveID, motiveName)
-			ch <- prometheus.MustNewConstMetric(cl.impfzentrumMetric, prometheus.GaugeValue, 1, center.Name, motiveName, "false")
+			ch <- prometheus.MustNewConstMetric(cl.impfzentrumMetric, prometheus.GaugeValue, 1, append(MotiveLabels(center, motiveID, motiveName), "false")...)
 		}
-		for _, v := range center.DisabledVaccination {
-			ch <- prometheus.MustNewConstMetric(cl.impfzentrumMetric, prometheus.GaugeValue, 1, center.Name, v, "true")
+		for motiveID, v := range center.DisabledVaccination {
+			ch <- prometheus.MustNewConstMetric(cl.impfzentrumMetric, prometheus.GaugeValue, 1, append(MotiveLabels(center, motiveID, v), "true")...)
 		}
 
 	}
 
-	wg.Wait()
+	leadTimes := make([]float64, 0, len(snap.Observations))
+	for _, o := range snap.Observations {
+		labels := ObservationLabels(o)
+		ch <- prometheus.MustNewConstMetric(cl.availableSlots, prometheus.GaugeValue, float64(o.Slots), labels...)
+		ch <- prometheus.MustNewConstMetric(cl.futureVacc, prometheus.GaugeValue, float64(o.FutureVaccinations), labels...)
+		if o.NextSlot.IsZero() {
+			continue
+		}
+		nextSlot := o.NextSlot
+		ch <- prometheus.MustNewConstMetric(cl.nextSlotMetric, prometheus.GaugeValue, float64(nextSlot.Unix()), labels...)
+		ch <- prometheus.MustNewConstMetric(cl.nextSlotTimestamp, prometheus.GaugeValue, float64(o.NextSlotTime.Unix()), labels...)
+		calendarDays := float64(CalendarDays(snap.Time, nextSlot))
+		ch <- prometheus.MustNewConstMetric(cl.nextSlotDays, prometheus.GaugeValue, calendarDays, labels...)
+		if *smoothingAlpha > 0 {
+			ch <- prometheus.MustNewConstMetric(cl.nextSlotSmoothed, prometheus.GaugeValue, o.SmoothedDays, labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(cl.nextSlotBusDays, prometheus.GaugeValue, float64(BusinessDays(*holidayState, snap.Time, nextSlot)), labels...)
+		days := nextSlot.Sub(snap.Time).Hours() / 24
+		if days < 0 {
+			days = 0
+		}
+		leadTimes = append(leadTimes, days)
+	}
+
+	ch <- LeadTimeHistogram(cl.leadTimeMetric, leadTimes)
+
+	for key, days := range RegionEarliestSlotDays(snap) {
+		ch <- prometheus.MustNewConstMetric(cl.regionEarliest, prometheus.GaugeValue, float64(days), key.region, key.vaccine)
+	}
 
 }
 
-func main() {
-	prometheus.Register(&ImpfzentrenCollector{})
-	http.Handle("/metrics", promhttp.Handler())
-	log.Println("Listening on :2112")
-	http.ListenAndServe(":2112", nil)
+type cycleKey struct{}
+
+// NewCycle returns ctx carrying a new correlation ID and a logger prefixing all messages
+// with it, so the log lines, events and notifications of one collection cycle can be told apart.
+func NewCycle(ctx context.Context) (context.Context, *log.Logger) {
+	id := fmt.Sprintf("%08x", rand.Uint32())
+	return context.WithValue(ctx, cycleKey{}, id), cycleLogger(id)
 }
 
-func CollectAvailability(wg *sync.WaitGroup, ch chan<- prometheus.Metric, desc *prometheus.Desc, center Impfzentrum, motiveID int, motiveName string) {
-	defer wg.Done()
-	r, err := GetAvailabilities(center.ID, motiveID, center.AgendaIDs)
-	if err != nil {
-		log.Printf("Failed to get availabilities for %s: %s", center.Name, err)
-		return
+// cycleLogger returns a logger prefixing all messages with the correlation ID id,
+// the standard logger if id is empty.
+func cycleLogger(id string) *log.Logger {
+	if id == "" {
+		return log.Default()
 	}
-	var nextDate string
-	for _, a := range r.Availabilities {
-		if len(a.Slots) > 0 {
-			nextDate = a.Date
-			break
-		}
+	return log.New(log.Writer(), "cycle="+id+" ", log.Flags()|log.Lmsgprefix)
+}
 
-	}
-	if nextDate == "" {
-		nextDate = r.NextSlot
-	}
-	if nextDate != "" {
-		nextSlot, err := time.Parse("2006-01-02", nextDate)
-		if err != nil {
-			log.Printf("Failed to parse next slot %s: %s", nextDate, err)
-			return
-		}
-		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(nextSlot.Unix()), center.Name, motiveName)
+// CycleID returns the correlation ID of the collection cycle of ctx, empty outside of one.
+func CycleID(ctx context.Context) string {
+	id, _ := ctx.Value(cycleKey{}).(string)
+	return id
+}
 
+// LeadTimeHistogram builds a histogram of the given lead times (in days).
+func LeadTimeHistogram(desc *prometheus.Desc, leadTimes []float64) prometheus.Metric {
+	var sum float64
+	buckets := make(map[float64]uint64, len(leadTimeBuckets))
+	for _, days := range leadTimes {
+		sum += days
+		for _, b := range leadTimeBuckets {
+			if days <= b {
+				buckets[b]++
+			}
+		}
 	}
-
+	return prometheus.MustNewConstHistogram(desc, uint64(len(leadTimes)), sum, buckets)
 }
 
-func GetAvailabilities(practice int, motive int, aganda_ids []int) (*AvailbilitiesResponse, error) {
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := NewRootCommand().ExecuteContext(ctx); err != nil {
+		stop()
+		var exit *ExitCodeError
+		if !errors.As(err, &exit) || exit.Err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		switch {
+		case exit != nil:
+			os.Exit(exit.Code)
+		case once:
+			os.Exit(ExitError)
+		}
+		os.Exit(1)
+	}
+}
 
-	u, err := url.Parse("https://www.doctolib.de/availabilities.json")
-	if err != nil {
-		return nil, err
+// Serve runs the exporter until ctx is done.
+func Serve(ctx context.Context) error {
+	if err := cluster.Join(); err != nil {
+		return err
 	}
-	aids := make([]string, 0, len(aganda_ids))
-	for _, v := range aganda_ids {
-		aids = append(aids, strconv.Itoa(v))
+	if replica == nil {
+		if err := CheckRequestRate(ctx, *pollInterval); err != nil {
+			return err
+		}
 	}
-	params := url.Values{}
-	params.Add("start_date", time.Now().Format("2006-01-02"))
-	params.Add("visit_motive_ids", strconv.Itoa(motive))
-	params.Add("agenda_ids", strings.Join(aids, "-"))
-	params.Add("insurance_sector", "public")
-	params.Add("practice_ids", strconv.Itoa(practice))
-	params.Add("destroy_temporary", "true")
-	params.Add("limit", "4")
-
-	u.RawQuery = params.Encode()
-	log.Println("Calling", u)
 
-	resp, err := http.Get(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("Request %s failed: %w", u.String(), err)
+	poller := &Poller{Interval: *pollInterval}
+	if err := Register(&ImpfzentrenCollector{snapshot: poller.Snapshot}); err != nil {
+		return err
 	}
-	if resp.StatusCode > 399 {
-		return nil, fmt.Errorf("Request failed with: %s", resp.Status)
+	if err := RegisterInternal(cluster, scrapeStats, notifyStats, poolStats, changeStats, pipelineProbe, crawler, adaptive, lifecycle, mutes); err != nil {
+		return err
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Reading body failed: %s", err)
+	errorBudget.Notify = NotifyPause
+	if replica != nil {
+		log.Println("Replicating", replica.URL, "instead of polling Doctolib")
+		go replica.Run(ctx, poller)
+	} else {
+		go poller.Run(ctx)
+		go crawler.Run(ctx)
 	}
-	var availability AvailbilitiesResponse
-	if err := json.Unmarshal(body, &availability); err != nil {
-		return nil, fmt.Errorf("Failed to parse response %s: %w", string(body), err)
+	go cluster.Run(ctx)
+	go pipelineProbe.Run(ctx, poller.Snapshot)
+	crawler.snapshot = poller.Snapshot
+	mutes.snapshot = poller.Snapshot
+	go RunBackups(ctx)
+	pushed := make(chan struct{})
+	if pusher != nil {
+		go func() {
+			pusher.Run(ctx)
+			close(pushed)
+		}()
+	} else {
+		close(pushed)
 	}
 
-	return &availability, nil
-
+	HandleMetrics(http.DefaultServeMux)
+	http.HandleFunc("/probe", Probe)
+	http.Handle("/api/v1/availabilities", &APIHandler{snapshot: poller.Snapshot})
+	http.Handle("/api/v1/schema", SchemaHandler{})
+	http.Handle("/api/v1/schema/", SchemaHandler{})
+	http.Handle("/events", stream)
+	http.Handle("/calendar.ics", &CalendarHandler{snapshot: poller.Snapshot})
+	http.Handle("/", &Dashboard{snapshot: poller.Snapshot})
+	http.Handle("/admin/debug", AdminHandler(payloads))
+	http.Handle("/admin/burst", AdminHandler(burst))
+	http.Handle("/admin/broadcast", AdminHandler(BroadcastHandler{}))
+	http.Handle("/admin/mutes", AdminHandler(mutes))
+	http.Handle("/debug/requests", requestLog)
+	server := &http.Server{Addr: *listen}
+	server.RegisterOnShutdown(stream.Close)
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	log.Println("Listening on", *listen)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-pushed
+	FinalBackup()
+	return nil
 }
 
-func Impfzentren() ([]Impfzentrum, error) {
-	url := "https://www.doctolib.de/booking/ciz-berlin-berlin.json"
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("Request %s failed: %s", url, err)
-	}
-	if resp.StatusCode > 399 {
-		return nil, fmt.Errorf("Request failed with: %s", resp.Status)
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Reading body failed: %s", err)
+// NewHTTPClient returns the client for upstream requests according to the TLS fingerprint and browser profile flags.
+func NewHTTPClient() (*http.Client, error) {
+	var profile BrowserProfile
+	if *browserProfile != "" {
+		profiles, err := LoadBrowserProfiles(*browserProfiles)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if profile, ok = profiles[*browserProfile]; !ok {
+			return nil, fmt.Errorf("Unknown browser profile %q", *browserProfile)
+		}
 	}
-	var ciz CIZRespone
-	if err := json.Unmarshal(body, &ciz); err != nil {
-		return nil, fmt.Errorf("Failed to parse response %s: %s", string(body), err)
+	fingerprint := *tlsFingerprint
+	if fingerprint == "" {
+		fingerprint = profile.TLSFingerprint
 	}
 
-	motiveByID := map[int]string{}
-	for _, m := range ciz.Data.VisitMotives {
-		motiveByID[m.ID] = m.Name
-	}
-	practiceByID := map[int]*Impfzentrum{}
-	for _, p := range ciz.Data.Places {
-		if len(p.PractiseIDs) < 1 {
-			continue
+	var transport http.RoundTripper
+	if *egress != "" {
+		if *egressStrategy != "round-robin" && *egressStrategy != "weighted" {
+			return nil, fmt.Errorf("Unknown egress strategy %q", *egressStrategy)
 		}
-		practiceByID[p.PractiseIDs[0]] = &Impfzentrum{Name: p.Name, ID: p.PractiseIDs[0], Vaccination: map[int]string{}, DisabledVaccination: map[int]string{}}
-	}
-	for _, a := range ciz.Data.Agendas {
-		practiceByID[a.PracticeID].AgendaIDs = append(practiceByID[a.PracticeID].AgendaIDs, a.ID)
-		for _, motiveID := range a.VisitMotives {
-
-			if a.BookingDisabled || a.BookingTemporayDisabled {
-				practiceByID[a.PracticeID].DisabledVaccination[motiveID] = motiveByID[motiveID]
-			} else {
-				practiceByID[a.PracticeID].Vaccination[motiveID] = motiveByID[motiveID]
-			}
+		pool, err := NewEgressPool(*egress, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		pool.Weighted = *egressStrategy == "weighted"
+		pool.BanDuration = *egressBanDuration
+		if err := RegisterInternal(pool); err != nil {
+			return nil, err
 		}
+		transport = pool
+	} else {
+		t, err := NewTransport(fingerprint, NewDialer(nil), nil)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
 	}
-
-	result := []Impfzentrum{}
-	for _, p := range practiceByID {
-		result = append(result, *p)
+	if len(profile.Headers) > 0 {
+		transport = &headerTransport{headers: profile.Headers, next: transport}
 	}
+	return &http.Client{Transport: &observingTransport{next: transport}, Timeout: RequestTimeout()}, nil
+}
 
-	return result, nil
-
+// IsBlocked reports whether a response status indicates that Doctolib is blocking or throttling us.
+func IsBlocked(status int) bool {
+	return status == http.StatusForbidden || status == http.StatusTooManyRequests
 }
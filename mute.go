@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var muteStateFile = flag.String("mute-state-file", "", "JSON file persisting the mutes set via the admin API across restarts")
+
+// Mute silences the notifications of a center, or of one of its vaccination types, until it
+// expires. Muted centers are still polled. With Suppress their series are not exported either,
+// e.g. while a center is known to be closed.
+//
+// With Profile it snoozes all notifiers of a profile of the notify section instead, e.g.
+// after someone booked. With Ack it acknowledges the alerts about a vaccination type instead:
+// there are no alerts about it until a slot before NextSlot is offered, or Until if set.
+type Mute struct {
+	BookingPage string `json:"booking_page,omitempty"`
+	PracticeID  int    `json:"practice_id,omitempty"`
+	// MotiveID is 0 if all vaccination types of the center are muted.
+	MotiveID int    `json:"motive_id,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+	Ack      bool   `json:"ack,omitempty"`
+	// NextSlot is the date of the next slot when the alerts were acknowledged.
+	NextSlot string    `json:"next_slot,omitempty"`
+	Until    time.Time `json:"until"`
+	Suppress bool      `json:"suppress_metrics,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// muteKey identifies a mute, motive is 0 for the whole center.
+type muteKey struct {
+	center  centerKey
+	motive  int
+	profile string
+	ack     bool
+}
+
+func (m *Mute) key() muteKey {
+	return muteKey{centerKey{m.BookingPage, m.PracticeID}, m.MotiveID, m.Profile, m.Ack}
+}
+
+// active reports whether the mute is in effect at now, acknowledgements without Until
+// stay in effect until an earlier slot is offered.
+func (m *Mute) active(now time.Time) bool {
+	if m.Ack && m.Until.IsZero() {
+		return true
+	}
+	return now.Before(m.Until)
+}
+
+// String describes what is muted in log messages.
+func (k muteKey) String() string {
+	switch {
+	case k.profile != "":
+		return "profile " + k.profile
+	case k.ack:
+		return fmt.Sprintf("alerts about vaccination type %d of center %d on %s", k.motive, k.center.id, k.center.bookingPage)
+	case k.motive != 0:
+		return fmt.Sprintf("vaccination type %d of center %d on %s", k.motive, k.center.id, k.center.bookingPage)
+	}
+	return fmt.Sprintf("center %d on %s", k.center.id, k.center.bookingPage)
+}
+
+// Mutes are the mutes set via the admin API.
+type Mutes struct {
+	mu    sync.Mutex
+	mutes map[muteKey]*Mute
+	// snapshot returns the latest snapshot, the acknowledged next slots are taken from it
+	snapshot func() *Snapshot
+
+	untilDesc   *prometheus.Desc
+	snoozedDesc *prometheus.Desc
+	ackDesc     *prometheus.Desc
+}
+
+var mutes = &Mutes{mutes: map[muteKey]*Mute{}}
+
+// Load reads the persisted mutes, a missing file is no error. Expired mutes are dropped.
+func (m *Mutes) Load(file string) error {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Reading mutes failed: %s", err)
+	}
+	var list []*Mute
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("Failed to parse mutes %s: %s", file, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := clock.Now()
+	for _, mute := range list {
+		if mute.active(now) {
+			m.mutes[mute.key()] = mute
+		}
+	}
+	return nil
+}
+
+// save persists the mutes, m.mu must be held.
+func (m *Mutes) save(file string) error {
+	if file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// list returns the active mutes sorted by profile, center and vaccination type, m.mu must be held.
+func (m *Mutes) list() []*Mute {
+	now := clock.Now()
+	list := []*Mute{}
+	for key, mute := range m.mutes {
+		if !mute.active(now) {
+			delete(m.mutes, key)
+			continue
+		}
+		list = append(list, mute)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Profile != list[j].Profile {
+			return list[i].Profile < list[j].Profile
+		}
+		if list[i].BookingPage != list[j].BookingPage {
+			return list[i].BookingPage < list[j].BookingPage
+		}
+		if list[i].PracticeID != list[j].PracticeID {
+			return list[i].PracticeID < list[j].PracticeID
+		}
+		if list[i].MotiveID != list[j].MotiveID {
+			return list[i].MotiveID < list[j].MotiveID
+		}
+		return !list[i].Ack && list[j].Ack
+	})
+	return list
+}
+
+// Set adds or replaces a mute.
+func (m *Mutes) Set(mute Mute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mutes[mute.key()] = &mute
+	switch {
+	case mute.Ack && mute.Until.IsZero():
+		log.Printf("Acknowledged %s until a slot before %s is offered", mute.key(), mute.NextSlot)
+	case mute.Ack:
+		log.Printf("Acknowledged %s until a slot before %s is offered or until %s", mute.key(), mute.NextSlot, mute.Until.In(location).Format(time.RFC3339))
+	default:
+		log.Printf("Muted %s until %s", mute.key(), mute.Until.In(location).Format(time.RFC3339))
+	}
+	if err := m.save(*muteStateFile); err != nil {
+		log.Printf("Saving mutes failed: %s", err)
+	}
+}
+
+// Remove deletes a mute and reports whether there was one.
+func (m *Mutes) Remove(key muteKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mutes[key]; !ok {
+		return false
+	}
+	delete(m.mutes, key)
+	log.Printf("Unmuted %s", key)
+	if err := m.save(*muteStateFile); err != nil {
+		log.Printf("Saving mutes failed: %s", err)
+	}
+	return true
+}
+
+// lookup returns the mute of a vaccination type of a center, or of the whole center, nil if
+// there is none. m.mu must be held.
+func (m *Mutes) lookup(center centerKey, motiveID int, now time.Time) *Mute {
+	for _, key := range []muteKey{{center: center, motive: motiveID}, {center: center}} {
+		if mute, ok := m.mutes[key]; ok && mute.active(now) {
+			return mute
+		}
+	}
+	return nil
+}
+
+// Filter drops the notifications about muted vaccination types and clears the alert flag of
+// acknowledged ones. An alert about a slot before the acknowledged one ends the acknowledgement.
+func (m *Mutes) Filter(notifications []Notification) []Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.mutes) == 0 {
+		return notifications
+	}
+	now := clock.Now()
+	kept := notifications[:0]
+	ended := false
+	for _, n := range notifications {
+		center := centerKey{n.Event.BookingPage, n.Event.PracticeID}
+		if m.lookup(center, n.Event.MotiveID, now) != nil {
+			continue
+		}
+		key := muteKey{center: center, motive: n.Event.MotiveID, ack: true}
+		if ack, ok := m.mutes[key]; ok && n.Alert && ack.active(now) {
+			// dates compare as strings
+			if n.Event.NextSlot == "" || n.Event.NextSlot >= ack.NextSlot {
+				n.Alert = false
+			} else {
+				log.Printf("Alerting about %s again, a slot on %s is offered", key, n.Event.NextSlot)
+				delete(m.mutes, key)
+				ended = true
+			}
+		}
+		kept = append(kept, n)
+	}
+	if ended {
+		if err := m.save(*muteStateFile); err != nil {
+			log.Printf("Saving mutes failed: %s", err)
+		}
+	}
+	return kept
+}
+
+// Snoozed reports whether the notifiers of a profile are snoozed.
+func (m *Mutes) Snoozed(profile string) bool {
+	if profile == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mute, ok := m.mutes[muteKey{profile: profile}]
+	return ok && mute.active(clock.Now())
+}
+
+// nextSlot returns the date of the earliest free slot of a vaccination type at a center
+// in the latest snapshot, empty if there is none. m.mu must not be held, as the poller
+// filters the notifications while holding the snapshot.
+func (m *Mutes) nextSlot(center centerKey, motiveID int) string {
+	if m.snapshot == nil {
+		return ""
+	}
+	snap := m.snapshot()
+	if snap == nil {
+		return ""
+	}
+	next := ""
+	for _, o := range snap.Observations {
+		if keyOfCenter(o.Center) != center || o.MotiveID != motiveID || o.Slots == 0 || o.NextSlot.IsZero() {
+			continue
+		}
+		if day := o.NextSlot.Format("2006-01-02"); next == "" || day < next {
+			next = day
+		}
+	}
+	return next
+}
+
+// Suppress returns snap without the centers and vaccination types muted with Suppress.
+// snap itself is not modified.
+func (m *Mutes) Suppress(snap *Snapshot) *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	suppressed := func(c doctolib.Impfzentrum, motiveID int) bool {
+		mute := m.lookup(keyOfCenter(c), motiveID, clock.Now())
+		return mute != nil && mute.Suppress
+	}
+	suppressing := false
+	for _, mute := range m.mutes {
+		suppressing = suppressing || mute.Suppress
+	}
+	if !suppressing {
+		return snap
+	}
+	filtered := *snap
+	filtered.Centers = nil
+	for _, c := range snap.Centers {
+		if suppressed(c, 0) {
+			continue
+		}
+		c.Vaccination = suppressMotives(c, c.Vaccination, suppressed)
+		c.DisabledVaccination = suppressMotives(c, c.DisabledVaccination, suppressed)
+		filtered.Centers = append(filtered.Centers, c)
+	}
+	filtered.Observations = nil
+	for _, o := range snap.Observations {
+		if !suppressed(o.Center, o.MotiveID) {
+			filtered.Observations = append(filtered.Observations, o)
+		}
+	}
+	return &filtered
+}
+
+// suppressMotives returns a copy of motives without the suppressed ones.
+func suppressMotives(c doctolib.Impfzentrum, motives map[int]string, suppressed func(doctolib.Impfzentrum, int) bool) map[int]string {
+	kept := make(map[int]string, len(motives))
+	for id, name := range motives {
+		if !suppressed(c, id) {
+			kept[id] = name
+		}
+	}
+	return kept
+}
+
+// ServeHTTP lists the active mutes. POST mutes a center with the form values booking_page,
+// practice_id, duration (e.g. 168h) and optionally motive_id, suppress_metrics and reason.
+// With ack=true and motive_id it acknowledges the alerts about a vaccination type with free
+// slots instead, the duration is optional then. With profile and duration it snoozes the
+// notifiers of a profile. DELETE with the same values but the duration removes a mute.
+// It must be guarded by AdminHandler.
+func (m *Mutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		mute, err := parseMute(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			if !m.Remove(mute.key()) {
+				http.Error(w, "not muted", http.StatusNotFound)
+				return
+			}
+			break
+		}
+		if mute.Ack {
+			if mute.NextSlot = m.nextSlot(mute.key().center, mute.MotiveID); mute.NextSlot == "" {
+				http.Error(w, "no free slots to acknowledge", http.StatusConflict)
+				return
+			}
+		}
+		m.Set(*mute)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mu.Lock()
+	list := m.list()
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// parseMute reads the mute of a POST or DELETE request to ServeHTTP.
+func parseMute(r *http.Request) (*Mute, error) {
+	mute := &Mute{Profile: r.FormValue("profile"), Reason: r.FormValue("reason")}
+	var err error
+	if v := r.FormValue("ack"); v != "" {
+		if mute.Ack, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid ack")
+		}
+	}
+	if mute.Profile != "" {
+		if r.FormValue("booking_page") != "" || mute.Ack {
+			return nil, fmt.Errorf("profile cannot be combined with booking_page or ack")
+		}
+		known := false
+		for _, p := range notifierProfiles {
+			known = known || p == mute.Profile
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown profile %q", mute.Profile)
+		}
+	} else {
+		mute.BookingPage = r.FormValue("booking_page")
+		mute.PracticeID, err = strconv.Atoi(r.FormValue("practice_id"))
+		if mute.BookingPage == "" || err != nil || mute.PracticeID <= 0 {
+			return nil, fmt.Errorf("booking_page and practice_id or profile required")
+		}
+		if v := r.FormValue("motive_id"); v != "" {
+			if mute.MotiveID, err = strconv.Atoi(v); err != nil || mute.MotiveID <= 0 {
+				return nil, fmt.Errorf("invalid motive_id")
+			}
+		}
+		if mute.Ack && mute.MotiveID == 0 {
+			return nil, fmt.Errorf("ack requires motive_id")
+		}
+	}
+	if r.Method == http.MethodDelete {
+		return mute, nil
+	}
+	if v := r.FormValue("duration"); v != "" || !mute.Ack {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration")
+		}
+		mute.Until = clock.Now().Add(d)
+	}
+	if v := r.FormValue("suppress_metrics"); v != "" {
+		if mute.Suppress, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid suppress_metrics")
+		}
+		if mute.Suppress && (mute.Profile != "" || mute.Ack) {
+			return nil, fmt.Errorf("suppress_metrics requires a muted center")
+		}
+	}
+	return mute, nil
+}
+
+func (m *Mutes) Describe(ch chan<- *prometheus.Desc) {
+	if m.untilDesc == nil {
+		m.untilDesc = prometheus.NewDesc("impfe_muted_until_timestamp_seconds",
+			"Zeitpunkt, bis zu dem ein Impfzentrum (motive_id 0) oder eine Impfung stummgeschaltet ist",
+			[]string{"booking_page", "id", "motive_id", "suppressed"}, nil,
+		)
+		m.snoozedDesc = prometheus.NewDesc("impfe_snoozed_until_timestamp_seconds",
+			"Zeitpunkt, bis zu dem die Benachrichtigungen eines Profils pausiert sind",
+			[]string{"profile"}, nil,
+		)
+		m.ackDesc = prometheus.NewDesc("impfe_acknowledged_next_slot_timestamp_seconds",
+			"Naechster Termin beim Bestaetigen der Alarme zu einer Impfung, erst fruehere Termine alarmieren wieder",
+			[]string{"booking_page", "id", "motive_id"}, nil,
+		)
+	}
+	ch <- m.untilDesc
+	ch <- m.snoozedDesc
+	ch <- m.ackDesc
+}
+
+func (m *Mutes) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mute := range m.list() {
+		switch {
+		case mute.Profile != "":
+			ch <- prometheus.MustNewConstMetric(m.snoozedDesc, prometheus.GaugeValue, float64(mute.Until.Unix()), mute.Profile)
+		case mute.Ack:
+			if next, err := time.ParseInLocation("2006-01-02", mute.NextSlot, location); err == nil {
+				ch <- prometheus.MustNewConstMetric(m.ackDesc, prometheus.GaugeValue, float64(next.Unix()),
+					mute.BookingPage, strconv.Itoa(mute.PracticeID), strconv.Itoa(mute.MotiveID))
+			}
+		default:
+			ch <- prometheus.MustNewConstMetric(m.untilDesc, prometheus.GaugeValue, float64(mute.Until.Unix()),
+				mute.BookingPage, strconv.Itoa(mute.PracticeID), strconv.Itoa(mute.MotiveID), strconv.FormatBool(mute.Suppress))
+		}
+	}
+}
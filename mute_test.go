@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+func TestAcknowledgeAlerts(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	center := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel", BookingPage: "ciz-berlin-berlin", Vaccination: map[int]string{7: "Erstimpfung"}}
+	day := Day(c.Now()).AddDate(0, 0, 3)
+	snap := &Snapshot{Time: c.Now(), Centers: []doctolib.Impfzentrum{center}}
+	m := &Mutes{mutes: map[muteKey]*Mute{}, snapshot: func() *Snapshot { return snap }}
+	post := func(values url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/admin/mutes", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		return w
+	}
+	ack := url.Values{"booking_page": {center.BookingPage}, "practice_id": {"1"}, "motive_id": {"7"}, "ack": {"true"}}
+
+	if w := post(ack); w.Code != http.StatusConflict {
+		t.Errorf("acknowledging without free slots answered %d, want %d", w.Code, http.StatusConflict)
+	}
+	snap.Observations = []Observation{{Center: center, MotiveID: 7, Motive: "Erstimpfung", Slots: 2, NextSlot: day, NextSlotTime: day}}
+	if w := post(ack); w.Code != http.StatusOK {
+		t.Fatalf("acknowledging answered %d: %s", w.Code, w.Body)
+	}
+
+	alert := func(next time.Time) []Notification {
+		return []Notification{{Event: AvailabilityEvent{BookingPage: center.BookingPage, PracticeID: 1, MotiveID: 7, NextSlot: next.Format("2006-01-02"), Slots: 1}, Alert: true}}
+	}
+	c.Advance(30 * 24 * time.Hour)
+	if n := m.Filter(alert(day)); len(n) != 1 || n[0].Alert {
+		t.Errorf("alert about the acknowledged slot = %+v, want the notification without alert", n)
+	}
+	if n := m.Filter(alert(day.AddDate(0, 0, 1))); len(n) != 1 || n[0].Alert {
+		t.Errorf("alert about a later slot = %+v, want the notification without alert", n)
+	}
+	if n := m.Filter(alert(day.AddDate(0, 0, -1))); len(n) != 1 || !n[0].Alert {
+		t.Errorf("alert about an earlier slot = %+v, want an alert", n)
+	}
+	if n := m.Filter(alert(day)); len(n) != 1 || !n[0].Alert {
+		t.Errorf("alert after the acknowledgement ended = %+v, want an alert", n)
+	}
+}
+
+func TestSnoozeProfile(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	defer func(prev map[Notifier]string) { notifierProfiles = prev }(notifierProfiles)
+	notifierProfiles = map[Notifier]string{loopbackNotifier(make(chan Notification)): "family"}
+	m := &Mutes{mutes: map[muteKey]*Mute{}}
+
+	for values, code := range map[string]int{
+		"profile=family&duration=8h":                                http.StatusOK,
+		"profile=friends&duration=8h":                               http.StatusBadRequest,
+		"profile=family":                                            http.StatusBadRequest,
+		"profile=family&booking_page=ciz-berlin-berlin&duration=8h": http.StatusBadRequest,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/mutes?"+values, nil)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("POST %s answered %d, want %d", values, w.Code, code)
+		}
+	}
+	if !m.Snoozed("family") {
+		t.Error("profile family not snoozed")
+	}
+	if m.Snoozed("") {
+		t.Error("notifiers without profile snoozed")
+	}
+	c.Advance(8 * time.Hour)
+	if m.Snoozed("family") {
+		t.Error("profile family still snoozed after 8h")
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var bookingURLFormat = flag.String("booking-url-format", "https://www.doctolib.de/institut/berlin/%s", "Booking link of a booking page in notifications, %s is replaced by the slug")
+
+// NotifyConfig is the notify section of the config file.
+type NotifyConfig struct {
+	// Vaccines to notify about, e.g. biontech. Empty notifies about all.
+	Vaccines []string `yaml:"vaccines"`
+	// Template is the default message template of all notifiers.
+	Template MessageTemplate `yaml:"template"`
+	Telegram *TelegramConfig `yaml:"telegram"`
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Slack    []SlackConfig   `yaml:"slack"`
+	Discord  []DiscordConfig `yaml:"discord"`
+	SMTP     *SMTPConfig     `yaml:"smtp"`
+	Ntfy     []NtfyConfig    `yaml:"ntfy"`
+	Gotify   []GotifyConfig  `yaml:"gotify"`
+}
+
+// Selection restricts the notifications of a single notifier. Centers are practice IDs,
+// which survive renames, or regular expressions on the center name. Empty lists select everything.
+type Selection struct {
+	Vaccines []string `yaml:"vaccines"`
+	Centers  []string `yaml:"centers"`
+}
+
+// selector is a compiled Selection.
+type selector struct {
+	vaccines map[string]bool
+	centers  *matcher
+}
+
+func newSelector(s Selection) (selector, error) {
+	if err := validateVaccines(s.Vaccines); err != nil {
+		return selector{}, err
+	}
+	centers, err := newMatcher(s.Centers, true)
+	if err != nil {
+		return selector{}, err
+	}
+	sel := selector{vaccines: map[string]bool{}, centers: centers}
+	for _, v := range s.Vaccines {
+		sel.vaccines[v] = true
+	}
+	return sel, nil
+}
+
+// Selects reports whether the notification matches the selection.
+func (s selector) Selects(n Notification) bool {
+	if len(s.vaccines) > 0 && !s.vaccines[n.Event.Vaccine] {
+		return false
+	}
+	return s.centers == nil || s.centers.match(n.Event.PracticeID, n.Event.Center)
+}
+
+// SelectsCenter reports whether the selection names the center, as opposed to selecting all centers.
+func (s selector) SelectsCenter(id int, name string) bool {
+	return s.centers != nil && s.centers.match(id, name)
+}
+
+// Notification announces a changed availability of a vaccination type at a center.
+type Notification struct {
+	Event AvailabilityEvent
+	// Previous is the observation of the previous poll, nil if the vaccination type is new.
+	Previous *Observation
+	// NewSlots is set if there were no free slots before and now there are.
+	NewSlots bool
+	// Alert is set for new slots and next slots moved earlier by --notify-earlier-days,
+	// unless silenced by the cooldown. Only ChangeNotifiers get notifications without it.
+	Alert bool
+	// Confidence is ConfidenceConfirmed or ConfidenceListed if the slot was fetched again, see ConfirmSlots.
+	Confidence  string
+	BookingPage string
+	Link        string
+	// Group lists all alerts of a combined message sorted by the next slot, see Group.
+	// The other fields are those of the first of them.
+	Group []Notification
+}
+
+// Members returns the alerts of a combined message, the notification itself otherwise.
+func (n Notification) Members() []Notification {
+	if len(n.Group) > 0 {
+		return n.Group
+	}
+	return []Notification{n}
+}
+
+// Title returns a short summary of the notification.
+func (n Notification) Title() string {
+	if len(n.Group) > 1 {
+		centers := map[string]bool{}
+		for _, m := range n.Group {
+			centers[m.Event.Center] = true
+		}
+		return fmt.Sprintf("Freie Termine: %d Treffer in %d Impfzentren", len(n.Group), len(centers))
+	}
+	return fmt.Sprintf("Freie Termine: %s in %s", n.Event.Motive, n.Event.Center)
+}
+
+// Text returns the message body of the notification.
+func (n Notification) Text() string {
+	if len(n.Group) > 1 {
+		text := n.Title()
+		for _, m := range n.Group {
+			text += fmt.Sprintf("\n\n%s in %s\n%s\n%s", m.Event.Motive, m.Event.Center, m.slotsText(), m.Link)
+		}
+		return text
+	}
+	return fmt.Sprintf("%s\n%s\n%s", n.Title(), n.slotsText(), n.Link)
+}
+
+// slotsText describes the free slots of the notification.
+func (n Notification) slotsText() string {
+	text := fmt.Sprintf("ab %s, %d Termine", nextSlotText(n), n.Event.Slots)
+	switch n.Confidence {
+	case ConfidenceConfirmed:
+		text += " (bestaetigt)"
+	case ConfidenceListed:
+		text += " (gelistet, evtl. bereits reserviert)"
+	}
+	return text
+}
+
+// Notifier delivers notifications to one endpoint.
+type Notifier interface {
+	// Name identifies the notifier in logs and metrics. The part before
+	// a slash, e.g. webhook in webhook/example.com, selects the retry policy.
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// ChangeNotifier is implemented by notifiers interested in every availability change.
+// Other notifiers only get alerts.
+type ChangeNotifier interface {
+	AllChanges() bool
+}
+
+// BatchNotifier is a notifier collecting the notifications of a window into one message.
+type BatchNotifier interface {
+	// BatchWindow returns how long to collect notifications after the first, 0 disables batching.
+	BatchWindow() time.Duration
+}
+
+// wants reports whether the notifier is interested in the notification.
+func wants(notifier Notifier, n Notification) bool {
+	if mutes.Snoozed(notifierProfiles[notifier]) {
+		return false
+	}
+	if s, ok := notifier.(interface{ Selects(Notification) bool }); ok && !s.Selects(n) {
+		return false
+	}
+	if c, ok := notifier.(ChangeNotifier); ok && c.AllChanges() {
+		return true
+	}
+	return n.Alert
+}
+
+// DryRunner is implemented by notifiers which can verify their configuration without notifying.
+type DryRunner interface {
+	DryRun(ctx context.Context) error
+}
+
+// HTTPStatusError is returned when a notifier endpoint answers with an error status.
+type HTTPStatusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("Request failed with: %s: %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("Request failed with: %s", e.Status)
+}
+
+// Temporary reports whether the request may succeed when retried.
+func (e *HTTPStatusError) Temporary() bool {
+	return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+}
+
+// notifiers are the configured notifiers.
+var notifiers []Notifier
+
+// notifierProfiles are the profiles of the notifiers which have one in the notify section.
+var notifierProfiles = map[Notifier]string{}
+
+// SetupNotifiers creates the notifiers configured in the notify section.
+func SetupNotifiers() error {
+	notifiers = nil
+	notifierProfiles = map[Notifier]string{}
+	// pools holds the members of each pool by backend and pool name, with the profile of the first
+	var poolKeys []string
+	pools := map[string][]Notifier{}
+	poolProfiles := map[string]string{}
+	add := func(n Notifier, profile string) {
+		notifiers = append(notifiers, n)
+		if profile != "" {
+			notifierProfiles[n] = profile
+		}
+	}
+	addToPool := func(n Notifier, profile, pool string) {
+		if pool == "" {
+			add(n, profile)
+			return
+		}
+		key := notifierBackend(n) + "/" + pool
+		if _, ok := pools[key]; !ok {
+			poolKeys = append(poolKeys, key)
+			poolProfiles[key] = profile
+		}
+		pools[key] = append(pools[key], n)
+	}
+	if t := config.Notify.Telegram; t != nil {
+		n, err := NewTelegramNotifier(*t)
+		if err != nil {
+			return err
+		}
+		pool := ""
+		if len(t.Tokens) > 0 {
+			pool = "bots"
+		}
+		addToPool(n, t.Profile, pool)
+		for _, token := range t.Tokens {
+			bot := *t
+			bot.Token, bot.Tokens = token, nil
+			m, err := NewTelegramNotifier(bot)
+			if err != nil {
+				return err
+			}
+			addToPool(m, "", pool)
+		}
+	}
+	for _, w := range config.Notify.Webhooks {
+		n, err := NewWebhookNotifier(w)
+		if err != nil {
+			return err
+		}
+		addToPool(n, w.Profile, w.Pool)
+	}
+	for _, c := range config.Notify.Slack {
+		n, err := NewSlackNotifier(c)
+		if err != nil {
+			return err
+		}
+		addToPool(n, c.Profile, c.Pool)
+	}
+	for _, c := range config.Notify.Discord {
+		n, err := NewDiscordNotifier(c)
+		if err != nil {
+			return err
+		}
+		addToPool(n, c.Profile, c.Pool)
+	}
+	for _, c := range config.Notify.Ntfy {
+		n, err := NewNtfyNotifier(c)
+		if err != nil {
+			return err
+		}
+		addToPool(n, c.Profile, c.Pool)
+	}
+	for _, c := range config.Notify.Gotify {
+		n, err := NewGotifyNotifier(c)
+		if err != nil {
+			return err
+		}
+		addToPool(n, c.Profile, c.Pool)
+	}
+	if c := config.Notify.SMTP; c != nil {
+		n, err := NewSMTPNotifiers(*c)
+		if err != nil {
+			return err
+		}
+		for i, r := range n {
+			add(r, c.Recipients[i].Profile)
+		}
+	}
+	for _, key := range poolKeys {
+		members := pools[key]
+		if len(members) == 1 {
+			add(members[0], poolProfiles[key])
+			continue
+		}
+		add(NewNotifierPool(strings.SplitN(key, "/", 2)[1], members), poolProfiles[key])
+	}
+	return validateVaccines(config.Notify.Vaccines)
+}
+
+// validateVaccines checks the vaccine IDs of the notify section.
+func validateVaccines(ids []string) error {
+	for _, v := range ids {
+		known := false
+		for _, vaccine := range vaccines {
+			known = known || vaccine.ID == v
+		}
+		if !known {
+			return fmt.Errorf("Unknown vaccine %q in notify section of config %s", v, configName())
+		}
+	}
+	return nil
+}
+
+// postJSON posts v as JSON to url with the client of a notifier.
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := jsonRequest(ctx, url, v)
+	if err != nil {
+		return err
+	}
+	return doRequest(client, req)
+}
+
+// jsonRequest returns a request posting v as JSON to url.
+func jsonRequest(ctx context.Context, url string, v interface{}) (*http.Request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// doRequest sends the request of a notifier, error statuses are returned as HTTPStatusError.
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(msg)}
+	}
+	return nil
+}
+
+// nextSlotText returns the formatted date of the next slot, - if there is none.
+func nextSlotText(n Notification) string {
+	if t, err := ParseSlotTime(n.Event.NextSlot); err == nil {
+		return FormatDate(t)
+	}
+	return "-"
+}
+
+// notifierHTTPClient returns the HTTP client of a notifier using the timeout of its retry policy.
+func notifierHTTPClient(name string) *http.Client {
+	return &http.Client{Timeout: retryPolicies[name].Timeout}
+}
+
+// BookingLink returns the link to book at a booking page, preferring the link found by the crawler.
+func BookingLink(bookingPage string) string {
+	if t, ok := crawler.Target(bookingPage); ok && t.Link != "" {
+		return t.Link
+	}
+	return strings.ReplaceAll(*bookingURLFormat, "%s", bookingPage)
+}
+
+// DeepLink returns the booking link of an event preselecting the practice and
+// vaccination type. If the next slot is known, its agenda and start are encoded in
+// the fragment, which Doctolib uses to preselect the slot and otherwise ignores.
+func DeepLink(e AvailabilityEvent) string {
+	link := BookingLink(e.BookingPage)
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	q := u.Query()
+	practice := e.PracticeID
+	if e.Slot != nil {
+		practice = e.Slot.PracticeID
+	}
+	if practice != 0 {
+		q.Set("pid", fmt.Sprintf("practice-%d", practice))
+	}
+	if e.MotiveID > 0 {
+		q.Set("motiveIds[]", strconv.Itoa(e.MotiveID))
+	}
+	u.RawQuery = q.Encode()
+	u.Fragment = ""
+	if e.Slot == nil {
+		return u.String()
+	}
+	return u.String() + "#" + url.Values{
+		"agendaId": {strconv.Itoa(e.Slot.AgendaID)},
+		"start":    {e.Slot.Start.Format(time.RFC3339)},
+	}.Encode()
+}
+
+// Notifications returns a notification for every vaccination type of a configured vaccine
+// whose availability changed between prev and snap. Nothing is reported for the first poll,
+// afterwards vaccination types missing from prev, e.g. newly offered ones or whose request
+// failed, count as without free slots.
+func Notifications(prev, snap *Snapshot) []Notification {
+	if prev == nil {
+		return nil
+	}
+	wanted := map[string]bool{}
+	for _, v := range config.Notify.Vaccines {
+		wanted[v] = true
+	}
+	previous := map[seriesKey]Observation{}
+	for _, o := range prev.Observations {
+		previous[o.key()] = o
+	}
+	var notifications []Notification
+	for _, e := range Events(prev, snap) {
+		if len(wanted) > 0 && !wanted[e.Vaccine] {
+			continue
+		}
+		n := Notification{Event: e, BookingPage: e.BookingPage, Link: DeepLink(e)}
+		p, ok := previous[e.key()]
+		if ok {
+			n.Previous = &p
+		}
+		n.NewSlots = p.Slots == 0 && e.Slots > 0
+		n.Alert = n.NewSlots || ok && *notifyEarlierDays > 0 && movedEarlier(p, e) >= *notifyEarlierDays
+		notifications = append(notifications, n)
+	}
+	return notifications
+}
+
+// Dispatch delivers the notifications to all notifiers, retrying transient failures.
+// The alerts of a notifier are combined into one message unless --notify-group is disabled.
+func Dispatch(ctx context.Context, notifications []Notification) {
+	if *confirmSlots {
+		ConfirmSlots(ctx, notifications)
+	}
+	if !*notifyGroup {
+		DispatchTo(ctx, notifiers, notifications)
+		return
+	}
+	var changeNotifiers []Notifier
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		// notifiers of every change expect them one by one
+		if c, ok := n.(ChangeNotifier); ok && c.AllChanges() {
+			changeNotifiers = append(changeNotifiers, n)
+			continue
+		}
+		var alerts []Notification
+		for _, notification := range notifications {
+			if wants(n, notification) {
+				alerts = append(alerts, notification)
+			}
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+			grouper.Add(ctx, notifier, alerts)
+		}(n)
+	}
+	DispatchTo(ctx, changeNotifiers, notifications)
+	wg.Wait()
+}
+
+// DispatchTo delivers the notifications to the given notifiers.
+func DispatchTo(ctx context.Context, targets []Notifier, notifications []Notification) {
+	var wg sync.WaitGroup
+	for _, n := range targets {
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+			if b, ok := notifier.(BatchNotifier); ok && b.BatchWindow() > 0 {
+				var batch []Notification
+				for _, notification := range notifications {
+					if wants(notifier, notification) {
+						batch = append(batch, notification)
+					}
+				}
+				if len(batch) > 0 {
+					grouper.Batch(ctx, notifier, batch, b.BatchWindow())
+				}
+				return
+			}
+			for _, notification := range notifications {
+				if wants(notifier, notification) {
+					deliver(ctx, notifier, notification)
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// deliver sends a notification with the retry policy of the notifier.
+func deliver(ctx context.Context, notifier Notifier, notification Notification) {
+	backend := strings.SplitN(notifier.Name(), "/", 2)[0]
+	policy := retryPolicies[backend]
+	err := Retry(ctx, policy, func() error {
+		return notifier.Notify(ctx, notification)
+	})
+	// pipeline probes are exported separately
+	if _, probe := notifier.(loopbackNotifier); !probe {
+		notifyStats.Record(notifier.Name(), err)
+		if err == nil && !notification.Event.Time.IsZero() {
+			notifyStats.ObserveLatency(backend, clock.Now().Sub(notification.Event.Time))
+		}
+	}
+	if err != nil {
+		cycleLogger(notification.Event.Cycle).Printf("Notifying %s about %s failed: %s", notifier.Name(), notification.Title(), err)
+	}
+}
+
+// Upper bounds of the notification latency (in seconds) and batch size histograms.
+var (
+	notificationLatencyBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600}
+	batchSizeBuckets           = []float64{1, 2, 5, 10, 20, 50, 100, 200}
+)
+
+// NotifyStats counts the delivered and failed notifications per notifier and tracks the
+// latency from the poll detecting a change to its delivery per backend as well as the
+// sizes of the batches sent to webhooks.
+type NotifyStats struct {
+	mu         sync.Mutex
+	counts     map[[2]string]uint64
+	latencies  map[string]*histogram
+	batchSizes map[string]*histogram
+
+	desc, latencyDesc, batchDesc *prometheus.Desc
+}
+
+// histogram accumulates the samples of a const histogram.
+type histogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+// observe adds a sample to the histogram h of m, creating it if needed.
+func observe(m map[string]*histogram, label string, v float64, bounds []float64) {
+	h := m[label]
+	if h == nil {
+		h = &histogram{buckets: map[float64]uint64{}}
+		m[label] = h
+	}
+	h.count++
+	h.sum += v
+	for _, b := range bounds {
+		if v <= b {
+			h.buckets[b]++
+		}
+	}
+}
+
+// collectHistograms sends a histogram per label value.
+func collectHistograms(ch chan<- prometheus.Metric, desc *prometheus.Desc, m map[string]*histogram) {
+	for label, h := range m {
+		buckets := make(map[float64]uint64, len(h.buckets))
+		for b, n := range h.buckets {
+			buckets[b] = n
+		}
+		ch <- prometheus.MustNewConstHistogram(desc, h.count, h.sum, buckets, label)
+	}
+}
+
+var notifyStats = &NotifyStats{counts: map[[2]string]uint64{}, latencies: map[string]*histogram{}, batchSizes: map[string]*histogram{}}
+
+// ObserveLatency records the latency of a successful delivery through the backend.
+func (s *NotifyStats) ObserveLatency(backend string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	observe(s.latencies, backend, latency.Seconds(), notificationLatencyBuckets)
+}
+
+// ObserveBatch records the number of notifications of a batch sent to the notifier.
+func (s *NotifyStats) ObserveBatch(notifier string, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	observe(s.batchSizes, notifier, float64(size), batchSizeBuckets)
+}
+
+// Record counts a delivery attempt.
+func (s *NotifyStats) Record(notifier string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[[2]string{notifier, result}]++
+}
+
+func (s *NotifyStats) Describe(ch chan<- *prometheus.Desc) {
+	if s.desc == nil {
+		s.desc = prometheus.NewDesc("impfe_notifications_total",
+			"Versendete Benachrichtigungen je Kanal und Ergebnis",
+			[]string{"notifier", "result"}, nil,
+		)
+		s.latencyDesc = prometheus.NewDesc("impfe_notification_latency_seconds",
+			"Zeit von der Abfrage mit der Aenderung bis zur erfolgreichen Benachrichtigung je Backend",
+			[]string{"backend"}, nil,
+		)
+		s.batchDesc = prometheus.NewDesc("impfe_notification_batch_size",
+			"Benachrichtigungen je gebuendelt versendeter Nachricht an einen Webhook",
+			[]string{"notifier"}, nil,
+		)
+	}
+	ch <- s.desc
+	ch <- s.latencyDesc
+	ch <- s.batchDesc
+}
+
+func (s *NotifyStats) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([][2]string, 0, len(s.counts))
+	for k := range s.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+keys[i][1] < keys[j][0]+keys[j][1] })
+	for _, k := range keys {
+		ch <- prometheus.MustNewConstMetric(s.desc, prometheus.CounterValue, float64(s.counts[k]), k[0], k[1])
+	}
+	collectHistograms(ch, s.latencyDesc, s.latencies)
+	collectHistograms(ch, s.batchDesc, s.batchSizes)
+}
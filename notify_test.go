@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNotificationsAlertWithoutPreviousObservation(t *testing.T) {
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	day := Day(now).AddDate(0, 0, 2)
+	center := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel", BookingPage: "ciz-berlin-berlin", Vaccination: map[int]string{7: "Erstimpfung", 8: "Zweitimpfung"}}
+	none := Observation{Center: center, MotiveID: 7, Motive: "Erstimpfung"}
+	free := Observation{Center: center, MotiveID: 7, Motive: "Erstimpfung", Slots: 3, NextSlot: day, NextSlotTime: day}
+	freeSecond := Observation{Center: center, MotiveID: 8, Motive: "Zweitimpfung", Slots: 1, NextSlot: day, NextSlotTime: day}
+	snapshot := func(minutes int, observations ...Observation) *Snapshot {
+		return &Snapshot{Time: now.Add(time.Duration(minutes) * time.Minute), Centers: []doctolib.Impfzentrum{center}, Observations: observations}
+	}
+
+	tests := []struct {
+		name       string
+		prev, snap *Snapshot
+		alerts     int
+	}{
+		{"first poll", nil, snapshot(0, free), 0},
+		{"slots again", snapshot(0, none), snapshot(1, free), 1},
+		{"slots again after a failed request", snapshot(0), snapshot(1, free), 1},
+		{"newly offered", snapshot(0, none), snapshot(1, none, freeSecond), 1},
+		{"still free", snapshot(0, free), snapshot(1, free), 0},
+		{"no slots after a failed request", snapshot(0), snapshot(1, none), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts := 0
+			for _, n := range Notifications(tt.prev, tt.snap) {
+				if n.Alert {
+					alerts++
+					if !n.NewSlots {
+						t.Errorf("alert %s without NewSlots", n.Title())
+					}
+				}
+			}
+			if alerts != tt.alerts {
+				t.Errorf("got %d alerts, want %d", alerts, tt.alerts)
+			}
+		})
+	}
+}
+
+// slowNotifier takes delay to deliver a notification.
+type slowNotifier struct {
+	clock *FakeClock
+	delay time.Duration
+}
+
+func (n slowNotifier) Name() string { return "webhook/example.com" }
+
+func (n slowNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.clock.Advance(n.delay)
+	return nil
+}
+
+func TestNotificationLatency(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	defer func(s *NotifyStats) { notifyStats = s }(notifyStats)
+	notifyStats = &NotifyStats{counts: map[[2]string]uint64{}, latencies: map[string]*histogram{}, batchSizes: map[string]*histogram{}}
+	event := AvailabilityEvent{Time: c.Now()}
+	c.Advance(time.Second)
+	deliver(context.Background(), slowNotifier{c, 2 * time.Second}, Notification{Event: event})
+
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(notifyStats); err != nil {
+		t.Fatal(err)
+	}
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	for _, f := range families {
+		if f.GetName() != "impfe_notification_latency_seconds" {
+			continue
+		}
+		m := f.Metric[0]
+		if backend := labelValue(m, "backend"); backend != "webhook" {
+			t.Errorf("backend = %q, want webhook", backend)
+		}
+		h := m.GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() != 3 {
+			t.Errorf("latency histogram has %d samples summing to %gs, want one of 3s", h.GetSampleCount(), h.GetSampleSum())
+		}
+		for _, b := range h.Bucket {
+			want := uint64(0)
+			if b.GetUpperBound() >= 5 {
+				want = 1
+			}
+			if b.GetCumulativeCount() != want {
+				t.Errorf("bucket %g counts %d, want %d", b.GetUpperBound(), b.GetCumulativeCount(), want)
+			}
+		}
+		return
+	}
+	t.Error("impfe_notification_latency_seconds not exported")
+}
+
+func TestWebhookBatch(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	defer func(s *NotifyStats) { notifyStats = s }(notifyStats)
+	notifyStats = &NotifyStats{counts: map[[2]string]uint64{}, latencies: map[string]*histogram{}, batchSizes: map[string]*histogram{}}
+	bodies := make(chan []WebhookPayload, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("Webhook got no batch: %s", err)
+		}
+		bodies <- batch
+	}))
+	defer srv.Close()
+	n, err := NewWebhookNotifier(WebhookConfig{URL: srv.URL, BatchWindow: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := func(center string, slots int) Notification {
+		return Notification{Event: AvailabilityEvent{SchemaVersion: EventSchemaVersion, Center: center, Slots: slots}}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		DispatchTo(context.Background(), []Notifier{n}, []Notification{change("Tegel", 1)})
+		close(done)
+	}()
+	c.BlockUntil(t, 1)
+	// changes of later polls within the window join the batch, also of the same series
+	DispatchTo(context.Background(), []Notifier{n}, []Notification{change("Arena", 2), change("Tegel", 0)})
+	c.Advance(5 * time.Second)
+	select {
+	case batch := <-bodies:
+		if len(batch) != 3 || batch[0].Center != "Tegel" || batch[2].Slots != 0 {
+			t.Errorf("batch = %+v, want the 3 changes in order", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No batch posted after the window")
+	}
+	<-done
+	if h := notifyStats.batchSizes[n.Name()]; h == nil || h.count != 1 || h.sum != 3 {
+		t.Errorf("batch size histogram = %+v, want one batch of 3", h)
+	}
+}
+
+// endpointNotifier records the centers it was notified about and fails if down.
+type endpointNotifier struct {
+	mu      *sync.Mutex
+	centers map[string]bool
+	down    bool
+}
+
+func (n endpointNotifier) Name() string { return "telegram" }
+
+func (n endpointNotifier) Notify(ctx context.Context, notification Notification) error {
+	if n.down {
+		return errors.New("endpoint down")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.centers[notification.Event.Center] = true
+	return nil
+}
+
+func TestNotifierPoolRouting(t *testing.T) {
+	defer func(s *PoolStats) { poolStats = s }(poolStats)
+	poolStats = &PoolStats{deliveries: map[[2]string]uint64{}, failovers: map[string]uint64{}}
+	var mu sync.Mutex
+	endpoints := []endpointNotifier{{&mu, map[string]bool{}, false}, {&mu, map[string]bool{}, false}, {&mu, map[string]bool{}, false}}
+	p := NewNotifierPool("bots", []Notifier{endpoints[0], endpoints[1], endpoints[2]})
+	notification := func(i int) Notification {
+		return Notification{Event: AvailabilityEvent{BookingPage: "ciz-berlin-berlin", PracticeID: i, Center: strconv.Itoa(i), Motive: "Erstimpfung"}}
+	}
+	for i := 0; i < 300; i++ {
+		for repeat := 0; repeat < 2; repeat++ {
+			if err := p.Notify(context.Background(), notification(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	owner := map[string]int{}
+	for e, endpoint := range endpoints {
+		if len(endpoint.centers) < 30 {
+			t.Errorf("endpoint %d got %d of 300 series, want a share of each", e+1, len(endpoint.centers))
+		}
+		for center := range endpoint.centers {
+			if prev, ok := owner[center]; ok {
+				t.Errorf("series %s was routed to endpoint %d and %d", center, prev+1, e+1)
+			}
+			owner[center] = e
+		}
+	}
+	var delivered uint64
+	for _, n := range poolStats.deliveries {
+		delivered += n
+	}
+	if delivered != 600 {
+		t.Errorf("counted %d deliveries, want 600", delivered)
+	}
+
+	// the series of a failed endpoint fail over, the others keep theirs
+	down := NewNotifierPool("bots", []Notifier{endpoints[0], endpointNotifier{&mu, map[string]bool{}, true}, endpoints[2]})
+	for i := 0; i < 300; i++ {
+		if err := down.Notify(context.Background(), notification(i)); err != nil {
+			t.Fatalf("Failover failed: %s", err)
+		}
+	}
+	if poolStats.failovers["telegram/bots"] == 0 {
+		t.Error("no failover counted")
+	}
+	for center, e := range owner {
+		if e != 1 && !endpoints[e].centers[center] {
+			t.Errorf("series %s moved away from its healthy endpoint %d", center, e+1)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// testCenter is the fake center of test notifications.
+var testCenter = doctolib.Impfzentrum{ID: -2, Name: "Testzentrum (impfe notify-test)", BookingPage: "impfe-notify-test"}
+
+// notifierBackend returns the backend of a notifier, e.g. webhook for webhook/example.org.
+func notifierBackend(n Notifier) string {
+	return strings.SplitN(n.Name(), "/", 2)[0]
+}
+
+// SelectNotifiers returns the configured notifiers of backend, restricted to profile unless empty.
+func SelectNotifiers(backend, profile string) ([]Notifier, error) {
+	var selected []Notifier
+	available := map[string]bool{}
+	for _, n := range notifiers {
+		name := notifierBackend(n)
+		if p := notifierProfiles[n]; p != "" {
+			name += " --profile " + p
+		}
+		available[name] = true
+		if notifierBackend(n) == backend && (profile == "" || notifierProfiles[n] == profile) {
+			// every endpoint of a pool is tested
+			if p, ok := n.(*NotifierPool); ok {
+				selected = append(selected, p.members...)
+				continue
+			}
+			selected = append(selected, n)
+		}
+	}
+	if len(selected) > 0 {
+		return selected, nil
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("No notifier configured")
+	}
+	names := make([]string, 0, len(available))
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if profile != "" {
+		return nil, fmt.Errorf("No %s notifier with profile %q configured, available: %s", backend, profile, strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("No %s notifier configured, available: %s", backend, strings.Join(names, ", "))
+}
+
+// TestNotification returns a synthetic alert about free slots at a fake center tomorrow.
+func TestNotification() Notification {
+	now := clock.Now()
+	day := Day(now).AddDate(0, 0, 1)
+	motive := "Erstimpfung Covid-19 (BioNTech-Pfizer)"
+	e := NewAvailabilityEvent(Observation{Center: testCenter, MotiveID: -2, Motive: motive, NextSlot: day, NextSlotTime: day, Slots: 3,
+		Insurance: InsuranceSectors()[0]}, now)
+	return Notification{Event: e, NewSlots: true, Alert: true, BookingPage: testCenter.BookingPage, Link: BookingLink(testCenter.BookingPage)}
+}
+
+// RunNotifyTest sends a test notification through each selected notifier once, without retries
+// and regardless of its selection, and reports the result of every one of them.
+func RunNotifyTest(ctx context.Context, w io.Writer, backend, profile string) error {
+	selected, err := SelectNotifiers(backend, profile)
+	if err != nil {
+		return err
+	}
+	n := TestNotification()
+	failed := 0
+	for _, notifier := range selected {
+		name := notifier.Name()
+		if p := notifierProfiles[notifier]; p != "" {
+			name += " (" + p + ")"
+		}
+		if err := notifier.Notify(ctx, n); err != nil {
+			failed++
+			fmt.Fprintf(w, "%s: FAILED: %s\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: OK\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Test notification failed for %d of %d notifiers", failed, len(selected))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NtfyConfig configures a topic of a ntfy server.
+type NtfyConfig struct {
+	// Server URL, https://ntfy.sh if empty.
+	Server string `yaml:"server"`
+	Topic  string `yaml:"topic"`
+	// Token is an optional access token of protected topics.
+	Token string `yaml:"token"`
+	// Priority from 1 (min) to 5 (urgent), 4 if not set.
+	Priority  int             `yaml:"priority"`
+	Template  MessageTemplate `yaml:"template"`
+	Selection `yaml:",inline"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Pool spreads the notifications over the notifiers of the backend with the same pool, see NotifierPool.
+	Pool string `yaml:"pool"`
+}
+
+// NtfyNotifier publishes notifications to a ntfy topic.
+type NtfyNotifier struct {
+	selector
+	config NtfyConfig
+	format messageFormat
+	client *http.Client
+}
+
+// NewNtfyNotifier validates the config and returns the notifier.
+func NewNtfyNotifier(c NtfyConfig) (*NtfyNotifier, error) {
+	if c.Topic == "" {
+		return nil, fmt.Errorf("ntfy notifier needs a topic")
+	}
+	if c.Server == "" {
+		c.Server = "https://ntfy.sh"
+	}
+	if _, err := url.Parse(c.Server); err != nil {
+		return nil, fmt.Errorf("Invalid ntfy server %q: %s", c.Server, err)
+	}
+	if c.Priority == 0 {
+		c.Priority = 4
+	}
+	if c.Priority < 1 || c.Priority > 5 {
+		return nil, fmt.Errorf("ntfy priority must be between 1 and 5, got %d", c.Priority)
+	}
+	sel, err := newSelector(c.Selection)
+	if err != nil {
+		return nil, err
+	}
+	format, err := newMessageFormat(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &NtfyNotifier{selector: sel, config: c, format: format, client: notifierHTTPClient("ntfy")}, nil
+}
+
+func (n *NtfyNotifier) Name() string { return "ntfy" }
+
+func (n *NtfyNotifier) Notify(ctx context.Context, notification Notification) error {
+	return n.publish(ctx, n.format.Title(notification), n.format.Text(notification), "syringe", notification.Link)
+}
+
+func (n *NtfyNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return n.publish(ctx, title, text, "loudspeaker", "")
+}
+
+// publish posts a message to the topic, click is the optional link opened by tapping it.
+func (n *NtfyNotifier) publish(ctx context.Context, title, text, tags, click string) error {
+	u := strings.TrimSuffix(n.config.Server, "/") + "/" + url.PathEscape(n.config.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(text))
+	if err != nil {
+		return err
+	}
+	// headers must be ASCII, ntfy decodes RFC 2047 encoded words
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", title))
+	req.Header.Set("Priority", strconv.Itoa(n.config.Priority))
+	req.Header.Set("Tags", tags)
+	if click != "" {
+		req.Header.Set("Click", click)
+	}
+	if n.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	}
+	return doRequest(n.client, req)
+}
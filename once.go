@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Exit codes of --once and impfe check.
+const (
+	ExitFound = 0
+	ExitNone  = 1
+	ExitError = 2
+)
+
+// ExitCodeError ends the command with a specific exit code. Err is printed unless nil.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error { return e.Err }
+
+// available returns the observations of snap with free slots sorted by next slot.
+func available(snap *Snapshot) []Observation {
+	var result []Observation
+	for _, o := range snap.Observations {
+		if o.Slots > 0 {
+			result = append(result, o)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].NextSlotTime.Equal(result[j].NextSlotTime) {
+			return result[i].NextSlotTime.Before(result[j].NextSlotTime)
+		}
+		return result[i].Center.Name+result[i].Motive < result[j].Center.Name+result[j].Motive
+	})
+	return result
+}
+
+// Output formats of RunOnce.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	// OutputTSV prints tab separated lines of booking page, center, vaccine, dose,
+	// next slot, slot count and link.
+	OutputTSV = "tsv"
+)
+
+// RunOnce polls once and prints the vaccination types with free slots in the given output
+// format. It returns an ExitCodeError with ExitNone if there are none and ExitError if
+// polling failed.
+func RunOnce(ctx context.Context, w io.Writer, output string) error {
+	if output != OutputTable && output != OutputJSON && output != OutputTSV {
+		return &ExitCodeError{Code: ExitError, Err: fmt.Errorf("Unknown output format %q", output)}
+	}
+	snap, err := Poll(NewCycle(ctx))
+	if err != nil {
+		return &ExitCodeError{Code: ExitError, Err: err}
+	}
+	found := available(snap)
+	switch {
+	case output == OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(NewAvailabilitiesResponse(snap, func(o Observation) bool { return o.Slots > 0 })); err != nil {
+			return &ExitCodeError{Code: ExitError, Err: err}
+		}
+	case output == OutputTSV:
+		for _, o := range found {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", o.Center.BookingPage, o.Center.Name, VaccineLabel(o.Motive), DoseLabel(o.Motive),
+				o.NextSlot.Format("2006-01-02"), o.Slots, BookingLink(o.Center.BookingPage))
+		}
+	case len(found) == 0:
+		fmt.Fprintln(w, "Keine freien Termine")
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CENTER\tMOTIVE\tNEXT\tSLOTS\tLINK")
+		for _, o := range found {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", o.Center.Name, o.Motive, FormatDate(o.NextSlot), o.Slots, BookingLink(o.Center.BookingPage))
+		}
+		tw.Flush()
+		if isTerminal(w) {
+			fmt.Fprint(w, "\a")
+		}
+	}
+	if len(found) == 0 {
+		return &ExitCodeError{Code: ExitNone}
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
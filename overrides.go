@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// CenterOverride is an entry of the centers section of the config file. It applies to the
+// centers matching Match, practice IDs or regular expressions on the center name. Unset
+// settings keep the defaults of the flags and the filters section, later matching entries
+// override the settings of earlier ones.
+type CenterOverride struct {
+	Match []string `yaml:"match"`
+	// PollInterval replaces --poll-interval, or the interval of watch and tail.
+	PollInterval *time.Duration `yaml:"poll_interval"`
+	// Lookahead replaces --lookahead.
+	Lookahead *int `yaml:"lookahead"`
+	// RateLimit limits the requests per second to the center on top of --rate-limit, 0 disables it.
+	RateLimit *float64 `yaml:"rate_limit"`
+	RateBurst *int     `yaml:"rate_burst"`
+	// Motives replace the include or exclude list of the motives filter.
+	Motives struct {
+		Include []string `yaml:"include"`
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"motives"`
+}
+
+// centerOverride is a compiled CenterOverride.
+type centerOverride struct {
+	CenterOverride
+	centers                        *matcher
+	includeMotives, excludeMotives *matcher
+}
+
+// centerSettings are the settings of a center after applying the overrides, zero values keep the defaults.
+type centerSettings struct {
+	interval                       time.Duration
+	lookahead                      int
+	rateLimit                      float64
+	rateBurst                      int
+	includeMotives, excludeMotives *matcher
+}
+
+// CenterOverrides resolves the settings of the centers.
+type CenterOverrides struct {
+	overrides []centerOverride
+
+	mu       sync.Mutex
+	limiters map[centerKey]*TokenBucket
+}
+
+var overrides = &CenterOverrides{}
+
+// SetupOverrides compiles and validates the centers section of the config file.
+func SetupOverrides() error {
+	o := &CenterOverrides{limiters: map[centerKey]*TokenBucket{}}
+	for i, c := range config.Centers {
+		invalid := func(format string, args ...interface{}) error {
+			return fmt.Errorf("Center override %d in config %s: %s", i+1, configName(), fmt.Sprintf(format, args...))
+		}
+		compiled := centerOverride{CenterOverride: c}
+		var err error
+		if len(c.Match) == 0 {
+			return invalid("match must not be empty")
+		}
+		if compiled.centers, err = newMatcher(c.Match, true); err != nil {
+			return invalid("%s", err)
+		}
+		if compiled.includeMotives, err = newMatcher(c.Motives.Include, true); err != nil {
+			return invalid("%s", err)
+		}
+		if compiled.excludeMotives, err = newMatcher(c.Motives.Exclude, true); err != nil {
+			return invalid("%s", err)
+		}
+		switch {
+		case c.PollInterval != nil && *c.PollInterval < time.Second:
+			return invalid("poll_interval must be at least 1s, got %s", *c.PollInterval)
+		case c.Lookahead != nil && *c.Lookahead < 1:
+			return invalid("lookahead must be at least 1, got %d", *c.Lookahead)
+		case c.RateLimit != nil && *c.RateLimit < 0:
+			return invalid("rate_limit must not be negative, got %g", *c.RateLimit)
+		case c.RateBurst != nil && *c.RateBurst < 1:
+			return invalid("rate_burst must be at least 1, got %d", *c.RateBurst)
+		}
+		o.overrides = append(o.overrides, compiled)
+	}
+	overrides = o
+	return nil
+}
+
+// For returns the settings of a center.
+func (o *CenterOverrides) For(center doctolib.Impfzentrum) centerSettings {
+	s := centerSettings{rateBurst: 1}
+	if filter != nil {
+		s.includeMotives, s.excludeMotives = filter.includeMotives, filter.excludeMotives
+	}
+	for _, c := range o.overrides {
+		if !c.centers.match(center.ID, center.Name) {
+			continue
+		}
+		if c.PollInterval != nil {
+			s.interval = *c.PollInterval
+		}
+		if c.Lookahead != nil {
+			s.lookahead = *c.Lookahead
+		}
+		if c.RateLimit != nil {
+			s.rateLimit = *c.RateLimit
+		}
+		if c.RateBurst != nil {
+			s.rateBurst = *c.RateBurst
+		}
+		if c.includeMotives != nil {
+			s.includeMotives = c.includeMotives
+		}
+		if c.excludeMotives != nil {
+			s.excludeMotives = c.excludeMotives
+		}
+	}
+	return s
+}
+
+// Interval returns the poll interval of a center polled every interval by default.
+func (o *CenterOverrides) Interval(center doctolib.Impfzentrum, interval time.Duration) time.Duration {
+	if d := o.For(center).interval; d > 0 {
+		return d
+	}
+	return interval
+}
+
+// Tick returns the shortest poll interval of interval and the overrides.
+func (o *CenterOverrides) Tick(interval time.Duration) time.Duration {
+	for _, c := range o.overrides {
+		if c.PollInterval != nil && *c.PollInterval < interval {
+			interval = *c.PollInterval
+		}
+	}
+	return interval
+}
+
+// Motive reports whether a motive of a center is monitored.
+func (o *CenterOverrides) Motive(center doctolib.Impfzentrum, id int, name string) bool {
+	s := o.For(center)
+	if s.excludeMotives != nil && s.excludeMotives.match(id, name) {
+		return false
+	}
+	return s.includeMotives == nil || s.includeMotives.match(id, name)
+}
+
+// Context returns the context for querying a center with its lookahead.
+func (o *CenterOverrides) Context(ctx context.Context, center doctolib.Impfzentrum) context.Context {
+	if days := o.For(center).lookahead; days > 0 {
+		return context.WithValue(ctx, centerLookaheadKey{}, days)
+	}
+	return ctx
+}
+
+// Wait blocks until the rate limit of the center allows another request or ctx is done.
+func (o *CenterOverrides) Wait(ctx context.Context, center doctolib.Impfzentrum) error {
+	s := o.For(center)
+	if s.rateLimit <= 0 {
+		return nil
+	}
+	o.mu.Lock()
+	key := keyOfCenter(center)
+	limiter := o.limiters[key]
+	if limiter == nil || limiter.Rate != s.rateLimit || limiter.Burst != s.rateBurst {
+		limiter = NewTokenBucket(s.rateLimit, s.rateBurst)
+		o.limiters[key] = limiter
+	}
+	o.mu.Unlock()
+	return limiter.Wait(ctx)
+}
+
+type centerLookaheadKey struct{}
+
+// centerLookahead returns the lookahead of the center queried with ctx, days if it has no override.
+func centerLookahead(ctx context.Context, days int) int {
+	if d, ok := ctx.Value(centerLookaheadKey{}).(int); ok {
+		return d
+	}
+	return days
+}
+
+// CenterSchedule polls the centers at the intervals of their overrides for a command polling
+// every Interval. Polls happen at the shortest interval, see Tick, and skip the centers not due
+// yet, whose previous observations are carried over by Complete.
+type CenterSchedule struct {
+	Interval time.Duration
+
+	polled map[centerKey]time.Time
+}
+
+type dueKey struct{}
+
+// Tick returns the time until the next poll, shortened in burst mode.
+func (s *CenterSchedule) Tick() time.Duration {
+	return burst.PollInterval(overrides.Tick(s.Interval))
+}
+
+// Context returns the context of a poll which skips the centers not due yet.
+func (s *CenterSchedule) Context(ctx context.Context) context.Context {
+	now := clock.Now()
+	return context.WithValue(ctx, dueKey{}, func(center doctolib.Impfzentrum) bool {
+		last, ok := s.polled[keyOfCenter(center)]
+		return !ok || now.Sub(last) >= burst.PollInterval(overrides.Interval(center, s.Interval))
+	})
+}
+
+// Complete records the centers polled for snap and carries over the observations of the
+// skipped ones from prev, the previous snapshot of the schedule.
+func (s *CenterSchedule) Complete(prev, snap *Snapshot) {
+	if s.polled == nil {
+		s.polled = map[centerKey]time.Time{}
+	}
+	for _, c := range snap.Centers {
+		if key := keyOfCenter(c); !snap.skipped[key] {
+			s.polled[key] = snap.Time
+		}
+	}
+	if len(snap.skipped) == 0 || prev == nil {
+		return
+	}
+	for _, o := range prev.Observations {
+		if snap.skipped[keyOfCenter(o.Center)] {
+			snap.Observations = append(snap.Observations, o)
+		}
+	}
+	snap.hash = snap.Hash()
+}
+
+// due reports whether a center is polled with ctx, see CenterSchedule.
+func due(ctx context.Context, center doctolib.Impfzentrum) bool {
+	f, ok := ctx.Value(dueKey{}).(func(doctolib.Impfzentrum) bool)
+	return !ok || f(center)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCenterOverrides(t *testing.T) {
+	defer func(c Config, o *CenterOverrides, f *Filter) { config, overrides, filter = c, o, f }(config, overrides, filter)
+	filter = nil
+	setup := func(doc string) error {
+		config = Config{}
+		if err := yaml.Unmarshal([]byte(doc), &config); err != nil {
+			t.Fatal(err)
+		}
+		return SetupOverrides()
+	}
+
+	for _, doc := range []string{
+		"centers: [{poll_interval: 1m}]",
+		"centers: [{match: ['('], lookahead: 3}]",
+		"centers: [{match: [Tegel], poll_interval: 500ms}]",
+		"centers: [{match: [Tegel], lookahead: 0}]",
+		"centers: [{match: [Tegel], rate_limit: -1}]",
+		"centers: [{match: [Tegel], motives: {include: ['[']}}]",
+	} {
+		if err := setup(doc); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+
+	err := setup(`
+centers:
+- match: [Impfzentrum]
+  poll_interval: 2m
+  lookahead: 7
+  motives:
+    exclude: [Zweitimpfung]
+- match: [Tegel, "42"]
+  poll_interval: 20s
+  rate_limit: 0.5
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tegel := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel"}
+	arena := doctolib.Impfzentrum{ID: 2, Name: "Impfzentrum Arena"}
+	practice := doctolib.Impfzentrum{ID: 42, Name: "Praxis"}
+	for _, tt := range []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"interval of the later override", overrides.Interval(tegel, time.Minute), 20 * time.Second},
+		{"interval of the earlier override", overrides.Interval(arena, time.Minute), 2 * time.Minute},
+		{"interval without override", overrides.Interval(doctolib.Impfzentrum{ID: 3, Name: "Praxis"}, time.Minute), time.Minute},
+		{"interval of practice ID", overrides.Interval(practice, time.Minute), 20 * time.Second},
+		{"inherited lookahead", centerLookahead(overrides.Context(context.Background(), tegel), 4), 7},
+		{"default lookahead", centerLookahead(overrides.Context(context.Background(), practice), 4), 4},
+		{"rate limit", overrides.For(tegel).rateLimit, 0.5},
+		{"excluded motive", overrides.Motive(tegel, 7, "Zweitimpfung"), false},
+		{"included motive", overrides.Motive(practice, 7, "Zweitimpfung"), true},
+		{"tick", overrides.Tick(time.Minute), 20 * time.Second},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestCenterSchedule(t *testing.T) {
+	c := useFakeClock(t, time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC))
+	defer func(o *CenterOverrides) { overrides = o }(overrides)
+	fast := doctolib.Impfzentrum{ID: 1, BookingPage: "ciz-berlin-berlin", Name: "Impfzentrum Tegel"}
+	slow := doctolib.Impfzentrum{ID: 2, BookingPage: "ciz-berlin-berlin", Name: "Arena"}
+	interval := 20 * time.Second
+	overrides = &CenterOverrides{overrides: []centerOverride{{CenterOverride: CenterOverride{PollInterval: &interval}, centers: &matcher{ids: map[int]bool{1: true}}}}}
+	s := &CenterSchedule{Interval: time.Minute}
+	if s.Tick() != interval {
+		t.Errorf("tick = %s, want %s", s.Tick(), interval)
+	}
+
+	poll := func() *Snapshot {
+		ctx := s.Context(context.Background())
+		snap := &Snapshot{Time: c.Now(), Centers: []doctolib.Impfzentrum{fast, slow}, skipped: map[centerKey]bool{}}
+		for _, center := range snap.Centers {
+			if due(ctx, center) {
+				snap.Observations = append(snap.Observations, Observation{Center: center, MotiveID: 7, Slots: 1})
+			} else {
+				snap.skipped[keyOfCenter(center)] = true
+			}
+		}
+		return snap
+	}
+	prev := poll()
+	s.Complete(nil, prev)
+	for i, slowDue := range []bool{false, false, true} {
+		c.Advance(interval)
+		snap := poll()
+		if snap.skipped[keyOfCenter(fast)] || snap.skipped[keyOfCenter(slow)] == slowDue {
+			t.Errorf("poll %d skipped %v, want the slow center skipped: %t", i+1, snap.skipped, !slowDue)
+		}
+		s.Complete(prev, snap)
+		if len(snap.Observations) != 2 {
+			t.Errorf("poll %d has %d observations, want the skipped center carried over", i+1, len(snap.Observations))
+		}
+		prev = snap
+	}
+}
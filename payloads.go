@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+var (
+	dumpEvery    = flag.Int("dump-payloads-every", 0, "Log every Nth availabilities response body (0 disables)")
+	dumpMaxBytes = flag.Int("dump-max-bytes", 2048, "Maximum number of bytes logged per dumped response body")
+)
+
+// PayloadDumper logs a sample of upstream response bodies. Practices with debugging
+// enabled via the admin API have all their responses logged.
+type PayloadDumper struct {
+	mu    sync.Mutex
+	count uint64
+	debug map[int]bool
+}
+
+var payloads = &PayloadDumper{debug: map[int]bool{}}
+
+// Dump logs the body of the response for practice if it is sampled.
+func (d *PayloadDumper) Dump(practice int, url string, body []byte) {
+	d.mu.Lock()
+	d.count++
+	sampled := d.debug[practice] || (*dumpEvery > 0 && d.count%uint64(*dumpEvery) == 0)
+	d.mu.Unlock()
+	if !sampled {
+		return
+	}
+	// redact before truncating so no partial personal data is left over
+	body = redactor.Redact(body)
+	if *dumpMaxBytes > 0 && len(body) > *dumpMaxBytes {
+		log.Printf("Response of %s (%d of %d bytes): %s", url, *dumpMaxBytes, len(body), body[:*dumpMaxBytes])
+		return
+	}
+	log.Printf("Response of %s: %s", url, body)
+}
+
+// ServeHTTP lists the practices with debugging enabled, or toggles it
+// with POST ?practice=<id>&enabled=<bool>. It must be guarded by AdminHandler.
+func (d *PayloadDumper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		practice, err := strconv.Atoi(r.FormValue("practice"))
+		if err != nil {
+			http.Error(w, "invalid practice", http.StatusBadRequest)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			http.Error(w, "invalid enabled", http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		if enabled {
+			d.debug[practice] = true
+		} else {
+			delete(d.debug, practice)
+		}
+		d.mu.Unlock()
+		log.Printf("Payload debugging for practice %d set to %t", practice, enabled)
+	}
+
+	d.mu.Lock()
+	practices := make([]int, 0, len(d.debug))
+	for p := range d.debug {
+		practices = append(practices, p)
+	}
+	d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]int{"debug_practices": practices})
+}
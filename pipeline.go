@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var pipelineProbeInterval = flag.Duration("pipeline-probe-interval", 5*time.Minute, "Interval of the synthetic probe slot measuring the internal processing latency (0 disables)")
+
+// probeCenter is the fake center of the pipeline probe, it never shows up in metrics.
+var probeCenter = doctolib.Impfzentrum{ID: -1, Name: "impfe pipeline probe", BookingPage: "impfe-pipeline-probe"}
+
+// PipelineProbe periodically pushes a synthetic slot through event detection and
+// notification delivery to a loopback notifier and measures how long that takes.
+type PipelineProbe struct {
+	mu      sync.Mutex
+	latency time.Duration
+	last    time.Time
+
+	latencyDesc *prometheus.Desc
+	lastDesc    *prometheus.Desc
+}
+
+var pipelineProbe = &PipelineProbe{}
+
+// pipelineProbeTimeout bounds the wait for the probe slot to reach the loopback notifier.
+const pipelineProbeTimeout = time.Minute
+
+// loopbackNotifier delivers notifications to a channel.
+type loopbackNotifier chan Notification
+
+func (loopbackNotifier) Name() string { return "loopback" }
+
+func (l loopbackNotifier) Notify(ctx context.Context, n Notification) error {
+	select {
+	case l <- n:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run probes every interval until ctx is done.
+func (p *PipelineProbe) Run(ctx context.Context, snapshot func() *Snapshot) {
+	if *pipelineProbeInterval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(*pipelineProbeInterval):
+		}
+		p.Probe(ctx, snapshot())
+	}
+}
+
+// Probe injects a probe slot next to the observations of base (which may be nil)
+// so the processing works on data of a realistic size.
+func (p *PipelineProbe) Probe(ctx context.Context, base *Snapshot) {
+	start := clock.Now()
+	motive := "Pipeline-Probe"
+	if len(config.Notify.Vaccines) > 0 {
+		// pass the vaccine filter of the notifications
+		for _, v := range vaccines {
+			if v.ID == config.Notify.Vaccines[0] && len(v.Match) > 0 {
+				motive += " " + v.Match[0]
+			}
+		}
+	}
+	prev := &Snapshot{Time: start}
+	if base != nil {
+		prev.Centers, prev.Observations = base.Centers, append([]Observation(nil), base.Observations...)
+	}
+	next := &Snapshot{Time: start, Centers: prev.Centers, Observations: append([]Observation(nil), prev.Observations...)}
+	prev.Observations = append(prev.Observations, Observation{Center: probeCenter, MotiveID: -1, Motive: motive})
+	day := Day(start)
+	next.Observations = append(next.Observations, Observation{Center: probeCenter, MotiveID: -1, Motive: motive, Slots: 1, NextSlot: day, NextSlotTime: day})
+
+	loopback := make(loopbackNotifier, 1)
+	var probes []Notification
+	for _, n := range Notifications(prev, next) {
+		if n.BookingPage == probeCenter.BookingPage && n.NewSlots {
+			probes = append(probes, n)
+		}
+	}
+	if len(probes) == 0 {
+		// e.g. filtered by the notification settings, nothing would reach the loopback
+		log.Printf("Pipeline probe produced no notification")
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go DispatchTo(ctx, []Notifier{loopback}, probes)
+	select {
+	case <-loopback:
+	case <-clock.After(pipelineProbeTimeout):
+		log.Printf("Pipeline probe did not reach the loopback notifier within %s", pipelineProbeTimeout)
+		return
+	case <-ctx.Done():
+		return
+	}
+	latency := clock.Now().Sub(start)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latency = latency
+	p.last = clock.Now()
+}
+
+func (p *PipelineProbe) Describe(ch chan<- *prometheus.Desc) {
+	if p.latencyDesc == nil {
+		p.latencyDesc = prometheus.NewDesc("impfe_pipeline_latency_seconds",
+			"Dauer der internen Verarbeitung eines Proben-Termins bis zur Benachrichtigung",
+			nil, nil,
+		)
+		p.lastDesc = prometheus.NewDesc("impfe_pipeline_probe_timestamp_seconds",
+			"Zeitpunkt der letzten erfolgreichen Probe",
+			nil, nil,
+		)
+	}
+	ch <- p.latencyDesc
+	ch <- p.lastDesc
+}
+
+func (p *PipelineProbe) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(p.latencyDesc, prometheus.GaugeValue, p.latency.Seconds())
+	ch <- prometheus.MustNewConstMetric(p.lastDesc, prometheus.GaugeValue, float64(p.last.Unix()))
+}
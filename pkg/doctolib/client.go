@@ -0,0 +1,204 @@
+// Package doctolib queries vaccination centers and their availabilities from Doctolib.
+package doctolib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultBaseURL = "https://www.doctolib.de"
+
+// Client queries the Doctolib booking API.
+type Client struct {
+	// BaseURL of Doctolib, DefaultBaseURL if empty.
+	BaseURL string
+	// HTTPClient used for requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// InsuranceSector availabilities are queried for, "public" if empty.
+	InsuranceSector string
+	// Limit is the number of days to look ahead, 4 if zero.
+	Limit int
+	// OrphanAgenda is called for agendas referencing a practice without place, which are skipped.
+	OrphanAgenda func(bookingPage string, agendaID, practiceID int)
+}
+
+// NewClient returns a client for DefaultBaseURL using httpClient.
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{BaseURL: DefaultBaseURL, HTTPClient: httpClient}
+}
+
+// StatusError is returned when Doctolib answers with an error status.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Request failed with: %s", e.Status)
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(c.BaseURL, "/")
+}
+
+func (c *Client) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Request %s failed: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 399 {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading body failed: %w", err)
+	}
+	return body, nil
+}
+
+// GetAvailabilities returns the availabilities of a motive at a practice starting at start.
+func (c *Client) GetAvailabilities(ctx context.Context, practice int, motive int, agendaIDs []int, start time.Time) (*AvailbilitiesResponse, error) {
+
+	u, err := url.Parse(c.baseURL() + "/availabilities.json")
+	if err != nil {
+		return nil, err
+	}
+	aids := make([]string, 0, len(agendaIDs))
+	for _, v := range agendaIDs {
+		aids = append(aids, strconv.Itoa(v))
+	}
+	sector := c.InsuranceSector
+	if sector == "" {
+		sector = "public"
+	}
+	limit := c.Limit
+	if limit == 0 {
+		limit = 4
+	}
+	params := url.Values{}
+	params.Add("start_date", start.Format("2006-01-02"))
+	params.Add("visit_motive_ids", strconv.Itoa(motive))
+	params.Add("agenda_ids", strings.Join(aids, "-"))
+	params.Add("insurance_sector", sector)
+	params.Add("practice_ids", strconv.Itoa(practice))
+	params.Add("destroy_temporary", "true")
+	params.Add("limit", strconv.Itoa(limit))
+	u.RawQuery = params.Encode()
+
+	body, err := c.get(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	var availability AvailbilitiesResponse
+	if err := json.Unmarshal(body, &availability); err != nil {
+		return nil, fmt.Errorf("Failed to parse response %s: %w", string(body), err)
+	}
+
+	return &availability, nil
+
+}
+
+// Booking returns the raw booking page with the given slug.
+func (c *Client) Booking(ctx context.Context, bookingPage string) (*CIZRespone, error) {
+	body, err := c.get(ctx, c.baseURL()+"/booking/"+url.PathEscape(bookingPage)+".json")
+	if err != nil {
+		return nil, err
+	}
+	var ciz CIZRespone
+	if err := json.Unmarshal(body, &ciz); err != nil {
+		return nil, fmt.Errorf("Failed to parse response %s: %s", string(body), err)
+	}
+	return &ciz, nil
+}
+
+// Impfzentren returns the vaccination centers of a booking page.
+func (c *Client) Impfzentren(ctx context.Context, bookingPage string) ([]Impfzentrum, error) {
+	ciz, err := c.Booking(ctx, bookingPage)
+	if err != nil {
+		return nil, err
+	}
+
+	motiveByID := map[int]string{}
+	channelByID := map[int]string{}
+	for _, m := range ciz.Data.VisitMotives {
+		motiveByID[m.ID] = m.Name
+		channelByID[m.ID] = ChannelOnsite
+		if m.Telehealth {
+			channelByID[m.ID] = ChannelTelehealth
+		}
+	}
+	// a place may consist of several practices, all of them map to the same center
+	practiceByID := map[int]*Impfzentrum{}
+	var places []*Impfzentrum
+	for _, p := range ciz.Data.Places {
+		if len(p.PractiseIDs) < 1 {
+			continue
+		}
+		place := &Impfzentrum{Name: p.Name, ID: p.PractiseIDs[0], BookingPage: bookingPage, Vaccination: map[int]string{}, DisabledVaccination: map[int]string{}, OpeningHours: p.OpeningHours, Channels: map[int]string{}, Zipcode: p.Zipcode, City: p.City, PracticeAgendas: map[int][]int{}, MotivePractices: map[int][]int{}}
+		for _, id := range p.PractiseIDs {
+			if _, ok := practiceByID[id]; !ok {
+				practiceByID[id] = place
+			}
+		}
+		places = append(places, place)
+	}
+	for _, a := range ciz.Data.Agendas {
+		place, ok := practiceByID[a.PracticeID]
+		if !ok {
+			if c.OrphanAgenda != nil {
+				c.OrphanAgenda(bookingPage, a.ID, a.PracticeID)
+			}
+			continue
+		}
+		place.AgendaIDs = append(place.AgendaIDs, a.ID)
+		place.PracticeAgendas[a.PracticeID] = append(place.PracticeAgendas[a.PracticeID], a.ID)
+		for _, motiveID := range a.VisitMotives {
+			place.Channels[motiveID] = channelByID[motiveID]
+
+			if a.BookingDisabled || a.BookingTemporayDisabled {
+				place.DisabledVaccination[motiveID] = motiveByID[motiveID]
+			} else {
+				place.Vaccination[motiveID] = motiveByID[motiveID]
+				if !containsInt(place.MotivePractices[motiveID], a.PracticeID) {
+					place.MotivePractices[motiveID] = append(place.MotivePractices[motiveID], a.PracticeID)
+				}
+			}
+		}
+	}
+
+	result := []Impfzentrum{}
+	for _, p := range places {
+		result = append(result, *p)
+	}
+
+	return result, nil
+
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package doctolib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// SearchResponse is a result page of the public practitioner search.
+type SearchResponse struct {
+	Data struct {
+		Doctors []SearchResult `json:"doctors"`
+		Total   int            `json:"total"`
+	} `json:"data"`
+}
+
+type SearchResult struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name_with_title"`
+	Link    string `json:"link"`
+	Zipcode string `json:"zipcode"`
+	City    string `json:"city"`
+}
+
+// BookingPage returns the booking page slug the result links to.
+func (r SearchResult) BookingPage() string {
+	return path.Base(r.Link)
+}
+
+// Search returns a result page (starting at 1) of the practices offering speciality in place,
+// e.g. "impfung-covid-19-corona" in "berlin".
+func (c *Client) Search(ctx context.Context, speciality, place string, page int) (*SearchResponse, error) {
+	u := c.baseURL() + "/" + url.PathEscape(speciality) + "/" + url.PathEscape(place) + ".json?page=" + strconv.Itoa(page)
+	body, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	var result SearchResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("Failed to parse response %s: %w", string(body), err)
+	}
+	return &result, nil
+}
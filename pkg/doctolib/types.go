@@ -0,0 +1,111 @@
+package doctolib
+
+type Availability struct {
+	Date  string `json:"date"`
+	Slots []Slot `json:"slots"`
+}
+type Slot struct {
+	Start    string `json:"start_date"`
+	End      string `json:"end_date"`
+	Steps    []Step `json:"steps"`
+	AgendaID int    `json:"agenda_id"`
+}
+type Step struct {
+	Start         string `json:"start_date"`
+	End           string `json:"end_date"`
+	VititMotiveID int    `json:"visit_motive_id"`
+	AgendaID      int    `json:"agenda_id"`
+}
+type AvailbilitiesResponse struct {
+	Total                     int    `json:"total"`
+	Reason                    string `json:"reason"`
+	Message                   string `json:"message"`
+	NumberOfFutureVacinations int    `json:"number_future_vaccinations"`
+	NextSlot                  string `json:"next_slot"`
+	Availabilities            []Availability
+}
+
+type CIZRespone struct {
+	Data struct {
+		Places       []Place       `json:"places"`
+		Agendas      []Agenda      `json:"agendas"`
+		VisitMotives []VisitMotive `json:"visit_motives"`
+	} `json:"data"`
+}
+
+type Place struct {
+	Name         string         `json:"name"`
+	Zipcode      string         `json:"zipcode"`
+	City         string         `json:"city"`
+	PractiseIDs  []int          `json:"practice_ids"`
+	OpeningHours []OpeningHours `json:"opening_hours"`
+}
+
+// OpeningHours are the opening hours of a place on one weekday (0 or 7 is Sunday).
+type OpeningHours struct {
+	Day     int         `json:"day"`
+	Enabled bool        `json:"enabled"`
+	Ranges  [][2]string `json:"ranges"`
+}
+
+type Agenda struct {
+	ID                      int   `json:"id"`
+	VisitMotives            []int `json:"visit_motive_ids"`
+	PracticeID              int   `json:"practice_id"`
+	BookingDisabled         bool  `json:"booking_disabled"`
+	BookingTemporayDisabled bool  `json:"booking_temporary_disabled"`
+}
+
+type VisitMotive struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Telehealth bool   `json:"telehealth"`
+}
+
+const (
+	ChannelOnsite     = "onsite"
+	ChannelTelehealth = "telehealth"
+)
+
+// Impfzentrum is a vaccination center of a booking page with the motives bookable there.
+type Impfzentrum struct {
+	ID                  int
+	Name                string
+	BookingPage         string
+	DisabledVaccination map[int]string
+	Vaccination         map[int]string
+	AgendaIDs           []int
+	// PracticeAgendas holds the agendas per practice of the place, the first is ID.
+	PracticeAgendas map[int][]int
+	// MotivePractices holds the practices offering each motive.
+	MotivePractices map[int][]int
+	OpeningHours    []OpeningHours
+	Zipcode         string
+	City            string
+	// Channels holds the appointment channel of each motive, ChannelOnsite if missing.
+	Channels map[int]string
+}
+
+// Practices returns the practices offering a motive, ID if unknown.
+func (i Impfzentrum) Practices(motiveID int) []int {
+	if p := i.MotivePractices[motiveID]; len(p) > 0 {
+		return p
+	}
+	return []int{i.ID}
+}
+
+// Agendas returns the agendas of a practice, AgendaIDs if unknown.
+func (i Impfzentrum) Agendas(practiceID int) []int {
+	if a, ok := i.PracticeAgendas[practiceID]; ok {
+		return a
+	}
+	return i.AgendaIDs
+}
+
+// Channel returns the appointment channel of a motive.
+func (i Impfzentrum) Channel(motiveID int) string {
+	if c, ok := i.Channels[motiveID]; ok {
+		return c
+	}
+	return ChannelOnsite
+}
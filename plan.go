@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var channels = flag.String("channels", doctolib.ChannelOnsite, "Comma separated appointment channels to monitor (onsite, telehealth)")
+
+// ValidateChannels checks the configured appointment channels.
+func ValidateChannels() error {
+	for _, c := range strings.Split(*channels, ",") {
+		if c := strings.TrimSpace(c); c != doctolib.ChannelOnsite && c != doctolib.ChannelTelehealth {
+			return fmt.Errorf("Unknown appointment channel %q", c)
+		}
+	}
+	return nil
+}
+
+// BookingPages returns the configured booking page slugs followed by the discovered ones.
+func BookingPages() []string {
+	var pages []string
+	seen := map[string]bool{}
+	for _, p := range strings.Split(*bookingPages, ",") {
+		if p = strings.TrimSpace(p); p != "" && !seen[p] {
+			pages = append(pages, p)
+			seen[p] = true
+		}
+	}
+	for _, p := range crawler.Pages() {
+		if !seen[p] {
+			pages = append(pages, p)
+		}
+	}
+	return pages
+}
+
+// Plan returns the centers of all booking pages to monitor with all filters applied.
+// It only fails if none of the booking pages could be fetched.
+func Plan(ctx context.Context) ([]doctolib.Impfzentrum, error) {
+	return PlanPages(ctx, BookingPages())
+}
+
+// PlanPages returns the centers of the given booking pages with all filters applied.
+func PlanPages(ctx context.Context, pages []string) ([]doctolib.Impfzentrum, error) {
+	centers, _, err := planPages(ctx, pages)
+	return centers, err
+}
+
+// planPages is PlanPages additionally returning the booking pages fetched successfully.
+func planPages(ctx context.Context, pages []string) ([]doctolib.Impfzentrum, map[string]bool, error) {
+	var centers []doctolib.Impfzentrum
+	var lastErr error
+	failed := 0
+	fetched := map[string]bool{}
+	for _, page := range pages {
+		start := clock.Now()
+		c, err := source.Impfzentren(ctx, page)
+		scrapeStats.Observe(page, nil, start, err)
+		if err != nil {
+			log.Printf("Failed to fetch booking page %s: %s", page, err)
+			lastErr = err
+			failed++
+			continue
+		}
+		fetched[page] = true
+		centers = append(centers, c...)
+	}
+	if failed > 0 && failed == len(pages) {
+		return nil, nil, lastErr
+	}
+	eligibleAges, err := ParseAges()
+	if err != nil {
+		return nil, nil, err
+	}
+	allowed := map[string]bool{}
+	for _, c := range strings.Split(*channels, ",") {
+		allowed[strings.TrimSpace(c)] = true
+	}
+	allowedRegions := RegionFilter()
+	var selected []doctolib.Impfzentrum
+	for _, c := range centers {
+		if (allowedRegions == nil || allowedRegions[Region(c)]) && filter.Center(c) {
+			selected = append(selected, c)
+		}
+	}
+	centers = selected
+	for _, c := range centers {
+		for id, name := range c.Vaccination {
+			if !allowed[c.Channel(id)] || !Eligible(name, eligibleAges) || !overrides.Motive(c, id, name) {
+				delete(c.Vaccination, id)
+			}
+		}
+		for id, name := range c.DisabledVaccination {
+			if !allowed[c.Channel(id)] || !Eligible(name, eligibleAges) || !overrides.Motive(c, id, name) {
+				delete(c.DisabledVaccination, id)
+			}
+		}
+	}
+	return centers, fetched, nil
+}
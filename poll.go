@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// Snapshot is the result of polling all centers once.
+type Snapshot struct {
+	Time         time.Time
+	Centers      []doctolib.Impfzentrum
+	Observations []Observation
+	// Planned is the number of upstream requests of the poll.
+	Planned int
+	// hash of the availabilities, see Hash
+	hash uint64
+	// fetched are the booking pages fetched successfully by the poll
+	fetched map[string]bool
+	// skipped are the centers not due yet, see CenterSchedule
+	skipped map[centerKey]bool
+	// Cycle is the correlation ID of the poll, see NewCycle.
+	Cycle string
+}
+
+// Observation is the availability of one vaccination type at a center.
+type Observation struct {
+	Center   doctolib.Impfzentrum
+	MotiveID int
+	Motive   string
+	// NextSlot is the date of the next free slot as midnight in the configured time zone, zero if there is none.
+	NextSlot time.Time
+	// NextSlotTime is the start of the next free slot, midnight of NextSlot if only the date is known.
+	NextSlotTime time.Time
+	// NextSlotPractice and NextSlotAgenda offer the next free slot, zero if only its date is known.
+	NextSlotPractice int
+	NextSlotAgenda   int
+	// Slots is the number of free slots within the lookahead window.
+	Slots int
+	// FutureVaccinations is the number of booked future vaccinations reported by Doctolib.
+	FutureVaccinations int
+	// Insurance is the insurance sector the availability was queried for.
+	Insurance string
+	// SmoothedDays is the exponential moving average of the calendar days until NextSlot.
+	SmoothedDays float64
+}
+
+// key returns the series of the observation.
+func (o Observation) key() seriesKey {
+	return seriesKey{keyOfCenter(o.Center), o.Motive, o.Insurance}
+}
+
+// Poller polls the availabilities in the background and caches the latest snapshot.
+type Poller struct {
+	Interval time.Duration
+
+	mu       sync.RWMutex
+	snapshot *Snapshot
+	smoothed map[seriesKey]float64
+	schedule *CenterSchedule
+}
+
+// Run polls every interval, or the burst interval while burst mode is active, until ctx is done.
+// Centers with a shorter poll interval in the config trigger polls of their own, see CenterSchedule.
+func (p *Poller) Run(ctx context.Context) {
+	for {
+		p.PollOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-burst.Changed():
+		case <-clock.After(p.centerSchedule().Tick()):
+		}
+	}
+}
+
+func (p *Poller) centerSchedule() *CenterSchedule {
+	if p.schedule == nil {
+		p.schedule = &CenterSchedule{Interval: p.Interval}
+	}
+	return p.schedule
+}
+
+// PollOnce polls once and caches the snapshot. On errors the previous snapshot is kept.
+func (p *Poller) PollOnce(ctx context.Context) {
+	ctx, logger := NewCycle(ctx)
+	if errorBudget.Paused() {
+		logger.Println("Polling paused, skipping poll")
+		return
+	}
+	schedule := p.centerSchedule()
+	snap, err := Poll(schedule.Context(ctx), logger)
+	if err != nil {
+		logger.Println("Error fetching impfzentren", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	schedule.Complete(p.snapshot, snap)
+	p.update(ctx, logger, snap)
+}
+
+// Apply caches a snapshot which was not polled by p, e.g. by a Replica, as if it was.
+// Its log lines are tagged with the correlation ID of the snapshot.
+func (p *Poller) Apply(ctx context.Context, snap *Snapshot) {
+	ctx, logger := context.WithValue(ctx, cycleKey{}, snap.Cycle), cycleLogger(snap.Cycle)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.update(ctx, logger, snap)
+}
+
+// update reconciles, publishes and notifies the changes of snap and caches it. p.mu must be held.
+func (p *Poller) update(ctx context.Context, logger *log.Logger, snap *Snapshot) {
+	lifecycle.Reconcile(ctx, p.snapshot, snap)
+	unchanged := Unchanged(p.snapshot, snap)
+	changeStats.Record(!unchanged)
+	if unchanged {
+		logger.Println("No availabilities changed since the last poll")
+	} else {
+		stream.Publish(StreamEvents(p.snapshot, snap))
+	}
+	if !unchanged && len(notifiers) > 0 {
+		if notifications := mutes.Filter(Notifications(p.snapshot, snap)); len(notifications) > 0 {
+			dedup.Filter(notifications, snap.Time)
+			go Dispatch(ctx, notifications)
+		}
+	}
+	// series missing from the snapshot, e.g. of retired centers, are not kept
+	smoothed := map[seriesKey]float64{}
+	for i, o := range snap.Observations {
+		key := o.key()
+		prev, ok := p.smoothed[key]
+		if o.NextSlot.IsZero() {
+			if ok {
+				smoothed[key] = prev
+			}
+			continue
+		}
+		days := float64(CalendarDays(snap.Time, o.NextSlot))
+		if ok && *smoothingAlpha > 0 {
+			days = *smoothingAlpha*days + (1-*smoothingAlpha)*prev
+		}
+		smoothed[key] = days
+		snap.Observations[i].SmoothedDays = days
+	}
+	p.smoothed = smoothed
+	p.snapshot = snap
+}
+
+// Snapshot returns the latest snapshot, nil if there was no successful poll yet.
+func (p *Poller) Snapshot() *Snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.snapshot
+}
+
+// Poll fetches the centers and the availabilities of all their enabled vaccination types.
+// When clustering, only the centers of the shard of this instance are polled.
+func Poll(ctx context.Context, logger *log.Logger) (*Snapshot, error) {
+	pages := BookingPages()
+	centers, fetched, err := planPages(ctx, pages)
+	if err != nil {
+		return nil, err
+	}
+	snap := pollCenters(ctx, logger, cluster.Partition(centers), len(pages))
+	snap.fetched = fetched
+	return snap, nil
+}
+
+// PollPages fetches the centers of the given booking pages and their availabilities.
+func PollPages(ctx context.Context, logger *log.Logger, pages []string) (*Snapshot, error) {
+	centers, fetched, err := planPages(ctx, pages)
+	if err != nil {
+		return nil, err
+	}
+	snap := pollCenters(ctx, logger, centers, len(pages))
+	snap.fetched = fetched
+	return snap, nil
+}
+
+// pollCenters fetches the availabilities of the centers, pages is the number of booking page requests.
+func pollCenters(ctx context.Context, logger *log.Logger, centers []doctolib.Impfzentrum, pages int) *Snapshot {
+	snap := &Snapshot{Time: clock.Now(), Centers: centers, Cycle: CycleID(ctx)}
+
+	type target struct {
+		center     doctolib.Impfzentrum
+		motiveID   int
+		motiveName string
+		insurance  string
+	}
+	var targets []target
+	for _, center := range centers {
+		if !due(ctx, center) {
+			if snap.skipped == nil {
+				snap.skipped = map[centerKey]bool{}
+			}
+			snap.skipped[keyOfCenter(center)] = true
+			continue
+		}
+		for motiveID, motiveName := range center.Vaccination {
+			for _, sector := range InsuranceSectors() {
+				targets = append(targets, target{center, motiveID, motiveName, sector})
+			}
+		}
+	}
+
+	// Avoid a perfectly periodic burst of requests in the same order on every poll.
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	// each target costs a request per practice offering the motive
+	if budget := RequestBudget(burst.PollInterval(*pollInterval), pages); budget > 0 {
+		kept, used := targets[:0], 0
+		for _, t := range targets {
+			if cost := len(t.center.Practices(t.motiveID)); used+cost <= budget {
+				kept = append(kept, t)
+				used += cost
+			}
+			if used == budget {
+				break
+			}
+		}
+		targets = kept
+	}
+	snap.Planned = pages
+	for _, t := range targets {
+		snap.Planned += len(t.center.Practices(t.motiveID))
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	jobs := make(chan target)
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				o, ok := FetchAvailability(WithInsuranceSector(ctx, t.insurance), logger, t.center, t.motiveID, t.motiveName)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				snap.Observations = append(snap.Observations, o)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, t := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		if i > 0 && *maxRequestSpacing > 0 {
+			clock.Sleep(time.Duration(rand.Int63n(int64(*maxRequestSpacing))))
+		}
+		jobs <- t
+	}
+	close(jobs)
+	wg.Wait()
+
+	snap.hash = snap.Hash()
+	return snap
+}
+
+// FetchAvailability fetches the availability of one vaccination type at a center for the
+// insurance sector of ctx, merged over all practices of the center offering it. It returns false if the availability
+// could not be determined for any of them.
+func FetchAvailability(ctx context.Context, logger *log.Logger, center doctolib.Impfzentrum, motiveID int, motiveName string) (Observation, bool) {
+	o := Observation{Center: center, MotiveID: motiveID, Motive: motiveName, Insurance: InsuranceSector(ctx)}
+	found := false
+	ctx = overrides.Context(ctx, center)
+	window := burst.CurrentLookahead(centerLookahead(ctx, *lookahead))
+	for _, practice := range center.Practices(motiveID) {
+		if err := overrides.Wait(ctx, center); err != nil {
+			logger.Printf("Failed to get availabilities for %s (practice %d): %s", center.Name, practice, err)
+			continue
+		}
+		start := clock.Now()
+		r, err := source.GetAvailabilities(adaptive.Context(ctx, practice, motiveID), practice, motiveID, center.Agendas(practice))
+		scrapeStats.Observe(center.BookingPage, &center, start, err)
+		if err != nil {
+			logger.Printf("Failed to get availabilities for %s (practice %d): %s", center.Name, practice, err)
+			continue
+		}
+		nextSlot, nextSlotTime, agendaID, err := nextAvailability(r)
+		if err != nil {
+			logger.Printf("Failed to parse next slot for %s (practice %d): %s", center.Name, practice, err)
+			continue
+		}
+		found = true
+		adaptive.Observe(ctx, practice, motiveID, !nextSlot.IsZero() && CalendarDays(clock.Now(), nextSlot) < window)
+		o.FutureVaccinations += r.NumberOfFutureVacinations
+		// slots beyond the regular window of an adaptive query are not counted
+		for i, a := range r.Availabilities {
+			if i < window {
+				o.Slots += len(a.Slots)
+			}
+		}
+		if !nextSlot.IsZero() && (o.NextSlot.IsZero() || nextSlot.Before(o.NextSlot)) {
+			o.NextSlot = nextSlot
+		}
+		if !nextSlotTime.IsZero() && (o.NextSlotTime.IsZero() || nextSlotTime.Before(o.NextSlotTime)) {
+			o.NextSlotTime = nextSlotTime
+			o.NextSlotPractice, o.NextSlotAgenda = 0, 0
+			if agendaID != 0 {
+				o.NextSlotPractice, o.NextSlotAgenda = practice, agendaID
+			}
+		}
+	}
+	return o, found
+}
+
+// nextAvailability returns the date of the next slot as midnight in the configured time zone,
+// its start time and agenda, all zero if there is none. The agenda is zero if only the date is known.
+func nextAvailability(r *doctolib.AvailbilitiesResponse) (nextSlot time.Time, nextSlotTime time.Time, agendaID int, err error) {
+	var nextDate string
+	for _, a := range r.Availabilities {
+		if len(a.Slots) > 0 && nextDate == "" {
+			nextDate = a.Date
+		}
+		for _, s := range a.Slots {
+			if t, err := ParseSlotTime(s.Start); err == nil && (nextSlotTime.IsZero() || t.Before(nextSlotTime)) {
+				nextSlotTime, agendaID = t, s.AgendaID
+			}
+		}
+	}
+	if nextDate == "" {
+		nextDate = r.NextSlot
+	}
+	if nextDate == "" {
+		return
+	}
+	t, err := ParseSlotTime(nextDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+	if nextSlotTime.IsZero() {
+		nextSlotTime = t
+	}
+	y, m, d := t.In(location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, location), nextSlotTime, agendaID, nil
+}
+
+// slotLayouts are the layouts Doctolib uses for dates and timestamps of slots.
+var slotLayouts = []string{
+	"2006-01-02",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// ParseSlotTime parses a date or timestamp of a slot. Values without a zone,
+// including plain dates, are interpreted in the configured time zone.
+func ParseSlotTime(value string) (time.Time, error) {
+	for _, layout := range slotLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unknown date format %q", value)
+}
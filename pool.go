@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolReplicas is the number of points of each endpoint on the hash ring of a pool.
+const poolReplicas = 64
+
+// NotifierPool spreads the notifications over equivalent endpoints of one backend, e.g. two
+// Telegram bots to share their API limits. The endpoint of a notification is chosen by
+// consistent hashing on its series, so a series sticks to its endpoint while others join or
+// leave, and the next endpoints on the ring take over if it fails. The selection and batch
+// window of the first endpoint apply to the whole pool.
+type NotifierPool struct {
+	name    string
+	members []Notifier
+	ring    []poolPoint
+}
+
+// poolPoint is a point of an endpoint on the hash ring.
+type poolPoint struct {
+	hash   uint64
+	member int
+}
+
+// NewNotifierPool returns the pool of the members, which must share the backend.
+func NewNotifierPool(name string, members []Notifier) *NotifierPool {
+	p := &NotifierPool{name: name, members: members}
+	for i := range members {
+		for r := 0; r < poolReplicas; r++ {
+			p.ring = append(p.ring, poolPoint{poolHash(strconv.Itoa(i) + "/" + strconv.Itoa(r)), i})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p
+}
+
+func poolHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// Name is the backend and the name of the pool, so the retry policy of the backend applies.
+func (p *NotifierPool) Name() string { return notifierBackend(p.members[0]) + "/" + p.name }
+
+// order returns the members in the order to try for a notification.
+func (p *NotifierPool) order(n Notification) []int {
+	key := n.Event.key()
+	h := poolHash(fmt.Sprintf("%s\x00%d\x00%s\x00%s", key.center.bookingPage, key.center.id, key.motive, key.insurance))
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	var order []int
+	seen := map[int]bool{}
+	for i := 0; len(order) < len(p.members); i++ {
+		m := p.ring[(start+i)%len(p.ring)].member
+		if !seen[m] {
+			seen[m] = true
+			order = append(order, m)
+		}
+	}
+	return order
+}
+
+// Notify delivers through the endpoint of the series, failing over to the next ones.
+func (p *NotifierPool) Notify(ctx context.Context, n Notification) error {
+	var err error
+	for i, m := range p.order(n) {
+		if i > 0 {
+			poolStats.Failover(p.Name())
+		}
+		if err = p.members[m].Notify(ctx, n); err == nil {
+			poolStats.Deliver(p.Name(), m)
+			return nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// Broadcast sends the message through the first endpoint which accepts it.
+func (p *NotifierPool) Broadcast(ctx context.Context, title, text string) error {
+	err := fmt.Errorf("No endpoint of pool %s supports broadcasts", p.name)
+	for _, m := range p.members {
+		if b, ok := m.(Broadcaster); ok {
+			if err = b.Broadcast(ctx, title, text); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// DryRun verifies all endpoints.
+func (p *NotifierPool) DryRun(ctx context.Context) error {
+	for _, m := range p.members {
+		if d, ok := m.(DryRunner); ok {
+			if err := d.DryRun(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *NotifierPool) Selects(n Notification) bool {
+	s, ok := p.members[0].(interface{ Selects(Notification) bool })
+	return !ok || s.Selects(n)
+}
+
+func (p *NotifierPool) SelectsCenter(id int, name string) bool {
+	s, ok := p.members[0].(interface{ SelectsCenter(int, string) bool })
+	return ok && s.SelectsCenter(id, name)
+}
+
+func (p *NotifierPool) AllChanges() bool {
+	c, ok := p.members[0].(ChangeNotifier)
+	return ok && c.AllChanges()
+}
+
+func (p *NotifierPool) BatchWindow() time.Duration {
+	if b, ok := p.members[0].(BatchNotifier); ok {
+		return b.BatchWindow()
+	}
+	return 0
+}
+
+// PoolStats counts the deliveries per endpoint of the notifier pools and their failovers.
+type PoolStats struct {
+	mu         sync.Mutex
+	deliveries map[[2]string]uint64
+	failovers  map[string]uint64
+
+	deliveriesDesc, failoversDesc *prometheus.Desc
+}
+
+var poolStats = &PoolStats{deliveries: map[[2]string]uint64{}, failovers: map[string]uint64{}}
+
+// Deliver counts a notification delivered by the endpoint with the index member.
+func (s *PoolStats) Deliver(pool string, member int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[[2]string{pool, strconv.Itoa(member + 1)}]++
+}
+
+// Failover counts an attempt of a further endpoint after a failed one.
+func (s *PoolStats) Failover(pool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failovers[pool]++
+}
+
+func (s *PoolStats) Describe(ch chan<- *prometheus.Desc) {
+	if s.deliveriesDesc == nil {
+		s.deliveriesDesc = prometheus.NewDesc("impfe_notifier_pool_deliveries_total",
+			"Zugestellte Benachrichtigungen je Pool und Endpunkt, nummeriert in der Reihenfolge der Konfiguration",
+			[]string{"pool", "endpoint"}, nil,
+		)
+		s.failoversDesc = prometheus.NewDesc("impfe_notifier_pool_failovers_total",
+			"Zustellversuche ueber einen weiteren Endpunkt eines Pools nach einem Fehler",
+			[]string{"pool"}, nil,
+		)
+	}
+	ch <- s.deliveriesDesc
+	ch <- s.failoversDesc
+}
+
+func (s *PoolStats) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, n := range s.deliveries {
+		ch <- prometheus.MustNewConstMetric(s.deliveriesDesc, prometheus.CounterValue, float64(n), k[0], k[1])
+	}
+	for pool, n := range s.failovers {
+		ch <- prometheus.MustNewConstMetric(s.failoversDesc, prometheus.CounterValue, float64(n), pool)
+	}
+}
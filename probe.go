@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Probe scrapes the booking page given as target on demand and serves the metrics of
+// just that page, like the blackbox_exporter does. This lets Prometheus service
+// discovery decide which booking pages are monitored.
+func Probe(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if !slugPattern.MatchString(target) {
+		http.Error(w, "invalid target, expected a booking page slug", http.StatusBadRequest)
+		return
+	}
+
+	successGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Abfrage der Buchungsseite erfolgreich",
+	})
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Dauer der Abfrage der Buchungsseite in Sekunden",
+	})
+	registry := prometheus.NewRegistry()
+	wrapped := prometheus.WrapRegistererWith(externalLabels, registry)
+	wrapped.MustRegister(successGauge, durationGauge)
+
+	start := clock.Now()
+	ctx, logger := NewCycle(r.Context())
+	var snap *Snapshot
+	if errorBudget.Paused() {
+		logger.Printf("Polling paused, skipping probe of %s", target)
+	} else if s, err := PollPages(ctx, logger, []string{target}); err != nil {
+		logger.Printf("Probe of %s failed: %s", target, err)
+	} else {
+		snap = s
+		// without history the moving average is the current value
+		for i, o := range snap.Observations {
+			if !o.NextSlot.IsZero() {
+				snap.Observations[i].SmoothedDays = float64(CalendarDays(snap.Time, o.NextSlot))
+			}
+		}
+		successGauge.Set(1)
+	}
+	durationGauge.Set(clock.Now().Sub(start).Seconds())
+	wrapped.MustRegister(&ImpfzentrenCollector{snapshot: func() *Snapshot { return snap }})
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	pushURL              = flag.String("push-url", "", "Push the metrics to this Pushgateway or prom-aggregation-gateway, credentials may be given as user info of the URL")
+	pushJob              = flag.String("push-job", "impfe", "Job label of the pushed metrics")
+	pushGrouping         = flag.String("push-grouping", "", "Comma separated key=value grouping labels of the pushed metrics besides the job, e.g. instance=berlin")
+	pushInterval         = flag.Duration("push-interval", time.Minute, "Interval for pushing the metrics")
+	pushMethod           = flag.String("push-method", "put", "put replaces all metrics of the group on every push, post only those pushed (use post for prom-aggregation-gateway)")
+	pushDeleteOnShutdown = flag.Bool("push-delete-on-shutdown", false, "Delete the metrics of the group from the Pushgateway on shutdown instead of leaving the last values")
+)
+
+// pusher pushes the metrics if push mode is enabled, nil otherwise.
+var pusher *MetricsPusher
+
+// MetricsPusher periodically pushes the exported metrics, for environments in which
+// Prometheus cannot scrape the exporter.
+type MetricsPusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	add      bool
+}
+
+// SetupPush validates the push flags and prepares the pusher. It must be called after SetupRegistry.
+func SetupPush() error {
+	pusher = nil
+	if *pushURL == "" {
+		return nil
+	}
+	u, err := url.Parse(*pushURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid push URL %q", *pushURL)
+	}
+	if *pushJob == "" {
+		return fmt.Errorf("Push job must not be empty")
+	}
+	if *pushMethod != "put" && *pushMethod != "post" {
+		return fmt.Errorf("Unknown push method %q, use put or post", *pushMethod)
+	}
+	if *pushInterval <= 0 {
+		return fmt.Errorf("Push interval must be positive, got %s", *pushInterval)
+	}
+	grouping, err := ParseExternalLabels(*pushGrouping)
+	if err != nil {
+		return fmt.Errorf("Invalid push grouping: %s", err)
+	}
+	for name := range grouping {
+		if _, ok := externalLabels[name]; ok || name == "job" {
+			return fmt.Errorf("Push grouping label %q collides with a label of the pushed series", name)
+		}
+		for _, l := range append(motiveLabelNames[:len(motiveLabelNames):len(motiveLabelNames)], reservedLabelNames...) {
+			if name == l && name != "instance" {
+				return fmt.Errorf("Push grouping label %q collides with a label of the pushed series", name)
+			}
+		}
+	}
+	user := u.User
+	u.User = nil
+	var g prometheus.Gatherer = registry
+	if internalRegistry != registry {
+		g = prometheus.Gatherers{registry, internalRegistry}
+	}
+	p := push.New(u.String(), *pushJob).Gatherer(g).Client(&http.Client{Timeout: 30 * time.Second})
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p = p.Grouping(name, grouping[name])
+	}
+	if user != nil {
+		password, _ := user.Password()
+		p = p.BasicAuth(user.Username(), password)
+	}
+	pusher = &MetricsPusher{pusher: p, interval: *pushInterval, add: *pushMethod == "post"}
+	return nil
+}
+
+// Push pushes the metrics once.
+func (m *MetricsPusher) Push() error {
+	if m.add {
+		return m.pusher.Add()
+	}
+	return m.pusher.Push()
+}
+
+// Run pushes every interval until ctx is done, then pushes a last time or deletes the group.
+func (m *MetricsPusher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			if *pushDeleteOnShutdown {
+				if err := m.pusher.Delete(); err != nil {
+					log.Printf("Deleting the pushed metrics failed: %s", err)
+				}
+				return
+			}
+			if err := m.Push(); err != nil {
+				log.Printf("Pushing metrics failed: %s", err)
+			}
+			return
+		case <-clock.After(m.interval):
+		}
+		if err := m.Push(); err != nil {
+			log.Printf("Pushing metrics failed: %s", err)
+		}
+	}
+}
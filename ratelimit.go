@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+)
+
+var (
+	rateLimit = flag.Float64("rate-limit", 0, "Maximum upstream requests per second shared by all requests, 0 disables the limit")
+	rateBurst = flag.Int("rate-burst", 1, "Number of upstream requests which may be sent at once before the rate limit applies")
+)
+
+// TokenBucket limits the rate of operations to Rate per second with bursts of up to Burst.
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{Rate: rate, Burst: burst, tokens: float64(burst), last: clock.Now()}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if b == nil || b.Rate <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	now := clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.Rate
+	if b.tokens > float64(b.Burst) {
+		b.tokens = float64(b.Burst)
+	}
+	b.last = now
+	// take the token right away, waiters queue up behind each other via the negative balance
+	b.tokens--
+	wait := time.Duration(-b.tokens / b.Rate * float64(time.Second))
+	b.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+var redact = flag.Bool("redact", true, "Scrub personal data from logs and dumped payloads")
+
+// RedactionConfig is the redaction section of the config file extending the built-in rules.
+type RedactionConfig struct {
+	// Fields are JSON keys whose values are scrubbed.
+	Fields []string `yaml:"fields"`
+	// Patterns are regular expressions whose matches are scrubbed.
+	Patterns []string `yaml:"patterns"`
+}
+
+// defaultRedactionFields are the personal data fields of authenticated Doctolib responses.
+var defaultRedactionFields = []string{
+	"first_name", "last_name", "maiden_name", "email", "phone_number", "secondary_phone_number",
+	"birthdate", "address", "zipcode", "city", "insurance_number", "patient_id", "patient_ids",
+	"master_patient_id", "token", "csrf_token", "session_id",
+}
+
+// defaultRedactionPatterns catch personal data outside of known fields.
+var defaultRedactionPatterns = []string{
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	`\+49[0-9 ()/-]{6,}[0-9]`,
+}
+
+const redacted = "[REDACTED]"
+
+// RedactionRule replaces the matches of a pattern.
+type RedactionRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+	// JSONValue replaces the JSON value following each match instead of the match itself.
+	JSONValue bool
+}
+
+// Redactor scrubs personal data by applying its rules in order.
+type Redactor struct {
+	Rules []RedactionRule
+}
+
+// NewRedactor returns a redactor for the given JSON fields and patterns.
+func NewRedactor(fields, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	if len(fields) > 0 {
+		quoted := make([]string, 0, len(fields))
+		for _, f := range fields {
+			quoted = append(quoted, regexp.QuoteMeta(f))
+		}
+		r.Rules = append(r.Rules, RedactionRule{
+			Pattern:     regexp.MustCompile(`"(?:` + strings.Join(quoted, "|") + `)"\s*:\s*`),
+			Replacement: `"` + redacted + `"`,
+			JSONValue:   true,
+		})
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redaction pattern %q: %s", p, err)
+		}
+		r.Rules = append(r.Rules, RedactionRule{Pattern: re, Replacement: redacted})
+	}
+	return r, nil
+}
+
+// Redact returns data with all personal data replaced.
+func (r *Redactor) Redact(data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	for _, rule := range r.Rules {
+		if rule.JSONValue {
+			data = rule.replaceValues(data)
+		} else {
+			data = rule.Pattern.ReplaceAll(data, []byte(rule.Replacement))
+		}
+	}
+	return data
+}
+
+// replaceValues replaces the JSON values following the matches of the pattern.
+func (rule RedactionRule) replaceValues(data []byte) []byte {
+	var out []byte
+	last := 0
+	for _, m := range rule.Pattern.FindAllIndex(data, -1) {
+		// matches within a replaced value are gone already
+		if m[0] < last {
+			continue
+		}
+		end := jsonValueEnd(data, m[1])
+		if end == m[1] {
+			continue
+		}
+		out = append(out, data[last:m[1]]...)
+		out = append(out, rule.Replacement...)
+		last = end
+	}
+	if out == nil {
+		return data
+	}
+	return append(out, data[last:]...)
+}
+
+// jsonValueEnd returns the end of the JSON value starting at i, or the end of data
+// if the value is cut off, e.g. in truncated payloads.
+func jsonValueEnd(data []byte, i int) int {
+	if i >= len(data) {
+		return i
+	}
+	switch data[i] {
+	case '"':
+		return jsonStringEnd(data, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(data); j++ {
+			switch data[j] {
+			case '"':
+				j = jsonStringEnd(data, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(data)
+	}
+	j := i
+	for j < len(data) && !strings.ContainsRune(",}] \t\r\n", rune(data[j])) {
+		j++
+	}
+	return j
+}
+
+// jsonStringEnd returns the end of the JSON string starting at i, or the end of data if it is cut off.
+func jsonStringEnd(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
+// redactor scrubs logs and payload dumps, nil if redaction is disabled.
+var redactor *Redactor
+
+// SetupRedaction builds the redactor from the built-in rules and the config file.
+func SetupRedaction() error {
+	if !*redact {
+		redactor = nil
+		return nil
+	}
+	r, err := NewRedactor(append(defaultRedactionFields, config.Redaction.Fields...), append(defaultRedactionPatterns, config.Redaction.Patterns...))
+	if err != nil {
+		return err
+	}
+	redactor = r
+	if _, ok := log.Writer().(redactingWriter); !ok {
+		log.SetOutput(redactingWriter{log.Writer()})
+	}
+	return nil
+}
+
+// redactingWriter scrubs everything written to the underlying writer.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(redactor.Redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestRedactFields(t *testing.T) {
+	r, err := NewRedactor([]string{"first_name", "email", "patient_ids", "address"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"string", `{"first_name":"Max","id":1}`, `{"first_name":"[REDACTED]","id":1}`},
+		{"escaped quote", `{"first_name":"Max \"M\"","id":1}`, `{"first_name":"[REDACTED]","id":1}`},
+		{"number and spacing", `{"email" : 42, "id":1}`, `{"email" : "[REDACTED]", "id":1}`},
+		{"null", `{"email":null}`, `{"email":"[REDACTED]"}`},
+		{"nested object", `{"patient":{"id":7,"first_name":"Max"}}`, `{"patient":{"id":7,"first_name":"[REDACTED]"}}`},
+		{"array of objects", `{"patients":[{"first_name":"Max"},{"first_name":"Erika"}]}`, `{"patients":[{"first_name":"[REDACTED]"},{"first_name":"[REDACTED]"}]}`},
+		{"array value", `{"patient_ids":[1,2,3],"id":1}`, `{"patient_ids":"[REDACTED]","id":1}`},
+		{"object value", `{"address":{"street":"Hauptstr. 1","city":"Berlin"},"id":1}`, `{"address":"[REDACTED]","id":1}`},
+		{"deeply nested object value", `{"address":{"street":{"name":"Hauptstr."},"city":"Berlin"},"id":1}`, `{"address":"[REDACTED]","id":1}`},
+		{"brackets in nested strings", `{"address":{"note":"a } b ]"},"id":1}`, `{"address":"[REDACTED]","id":1}`},
+		{"other fields untouched", `{"last_name":"Mustermann"}`, `{"last_name":"Mustermann"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r.Redact([]byte(tt.in))); got != tt.want {
+				t.Errorf("Redact(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPatterns(t *testing.T) {
+	r, err := NewRedactor(nil, defaultRedactionPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"email", "Mail an max.mustermann@example.org gesendet", "Mail an [REDACTED] gesendet"},
+		{"phone", "Rueckruf unter +49 30 1234567.", "Rueckruf unter [REDACTED]."},
+		{"phone with separators", "Tel. +49 (030) 123-45/67", "Tel. [REDACTED]"},
+		{"several matches", "a@b.de und c@d.de", "[REDACTED] und [REDACTED]"},
+		{"no match", "Impfzentrum Berlin, 3 freie Termine", "Impfzentrum Berlin, 3 freie Termine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r.Redact([]byte(tt.in))); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+	if _, err := NewRedactor(nil, []string{"("}); err == nil {
+		t.Error("NewRedactor accepted an invalid pattern")
+	}
+}
+
+func TestRedactTruncated(t *testing.T) {
+	r, err := NewRedactor(defaultRedactionFields, defaultRedactionPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"cut inside value", `{"id":1,"first_name":"Ma`, `{"id":1,"first_name":"[REDACTED]"`},
+		{"cut inside escape", `{"last_name":"Muster\`, `{"last_name":"[REDACTED]"`},
+		{"cut inside array", `{"patient_ids":[1,2`, `{"patient_ids":"[REDACTED]"`},
+		{"cut after key", `{"email":`, `{"email":`},
+		{"cut inside email", `{"note":"max@example.org fragt`, `{"note":"[REDACTED] fragt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r.Redact([]byte(tt.in))); got != tt.want {
+				t.Errorf("Redact(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactNil(t *testing.T) {
+	var r *Redactor
+	if got := string(r.Redact([]byte(`{"email":"a@b.de"}`))); got != `{"email":"a@b.de"}` {
+		t.Errorf("nil Redactor changed the data: %s", got)
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	r, err := NewRedactor(defaultRedactionFields, defaultRedactionPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev *Redactor) { redactor = prev }(redactor)
+	redactor = r
+
+	var buf bytes.Buffer
+	logger := log.New(redactingWriter{&buf}, "", 0)
+	tests := []struct {
+		name, in, want string
+	}{
+		{"message", "Login von max@example.org", "Login von [REDACTED]\n"},
+		{"payload", `Antwort {"first_name":"Max","visit_motive_id":7}`, `Antwort {"first_name":"[REDACTED]","visit_motive_id":7}` + "\n"},
+		{"clean", "Keine freien Termine", "Keine freien Termine\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			logger.Print(tt.in)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the length of the original is reported so callers do not see a short write
+	p := []byte("mail max@example.org\n")
+	if n, err := (redactingWriter{&buf}).Write(p); err != nil || n != len(p) {
+		t.Errorf("Write = %d, %v, want %d, nil", n, err, len(p))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var (
+	regionDigits = flag.Int("region-digits", 2, "Number of leading postal code digits forming a region if no configured region matches")
+	regions      = flag.String("regions", "", "Comma separated regions to monitor, configured names or postal code prefixes (empty monitors all)")
+)
+
+// RegionConfig is a user defined region in the regions section of the config file.
+type RegionConfig struct {
+	Name string `yaml:"name"`
+	// PostalCodes are postal codes, prefixes ending with * or ranges like 10115-10179.
+	PostalCodes []string `yaml:"postal_codes"`
+}
+
+// Matches reports whether a postal code belongs to the region.
+func (r RegionConfig) Matches(zip string) bool {
+	for _, p := range r.PostalCodes {
+		switch {
+		case strings.HasSuffix(p, "*"):
+			if strings.HasPrefix(zip, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		case strings.Contains(p, "-"):
+			bounds := strings.SplitN(p, "-", 2)
+			if len(zip) == len(bounds[0]) && zip >= bounds[0] && zip <= bounds[1] {
+				return true
+			}
+		case zip == p:
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRegions checks the regions section of the config file.
+func ValidateRegions() error {
+	seen := map[string]bool{}
+	for _, r := range config.Regions {
+		if r.Name == "" || r.Name == unknownRegion {
+			return fmt.Errorf("Invalid region name %q in config %s", r.Name, configName())
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("Duplicate region %q in config %s", r.Name, configName())
+		}
+		seen[r.Name] = true
+		for _, p := range r.PostalCodes {
+			if bounds := strings.SplitN(p, "-", 2); len(bounds) == 2 && (len(bounds[0]) != len(bounds[1]) || bounds[0] > bounds[1]) {
+				return fmt.Errorf("Invalid postal code range %q of region %s", p, r.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// RegionFilter returns the regions to monitor, nil if all are monitored.
+func RegionFilter() map[string]bool {
+	if *regions == "" {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, r := range strings.Split(*regions, ",") {
+		allowed[strings.TrimSpace(r)] = true
+	}
+	return allowed
+}
+
+// unknownRegion is the region of centers without a postal code.
+const unknownRegion = "unknown"
+
+// Region returns the region of a center derived from its postal code: the first configured
+// region containing it, else the postal code prefix. Centers of discovered booking pages
+// without an own postal code fall back to that of the search result.
+func Region(center doctolib.Impfzentrum) string {
+	zip := center.Zipcode
+	if zip == "" {
+		if t, ok := crawler.Target(center.BookingPage); ok {
+			zip = t.Zipcode
+		}
+	}
+	for _, r := range config.Regions {
+		if r.Matches(zip) {
+			return r.Name
+		}
+	}
+	if len(zip) < *regionDigits || *regionDigits < 1 {
+		return unknownRegion
+	}
+	return zip[:*regionDigits]
+}
+
+// regionKey identifies a vaccine in a region.
+type regionKey struct {
+	region, vaccine string
+}
+
+// RegionEarliestSlotDays returns the calendar days until the earliest slot per region and
+// normalized vaccine, so identical motives of many practices collapse into one series.
+// Motives of unknown vaccines are grouped as "unknown".
+func RegionEarliestSlotDays(snap *Snapshot) map[regionKey]int {
+	earliest := map[regionKey]int{}
+	for _, o := range snap.Observations {
+		if o.NextSlot.IsZero() {
+			continue
+		}
+		key := regionKey{Region(o.Center), VaccineLabel(o.Motive)}
+		days := CalendarDays(snap.Time, o.NextSlot)
+		if prev, ok := earliest[key]; !ok || days < prev {
+			earliest[key] = days
+		}
+	}
+	return earliest
+}
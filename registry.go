@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	disableGoMetrics    = flag.Bool("disable-go-metrics", false, "Do not export the metrics of the Go runtime, the process and the metrics handler")
+	internalMetricsPath = flag.String("internal-metrics-path", "", "Serve the metrics about the exporter itself on this path, e.g. /metrics/internal, instead of together with the availabilities on /metrics")
+)
+
+var (
+	// registry holds the collectors exported on /metrics.
+	registry = prometheus.NewRegistry()
+	// internalRegistry holds the metrics about the exporter itself, it is registry
+	// unless they are served separately.
+	internalRegistry = registry
+	// registerer and internalRegisterer register collectors with the external labels applied.
+	registerer         prometheus.Registerer = registry
+	internalRegisterer prometheus.Registerer = registry
+)
+
+// SetupRegistry prepares the registries of the exported metrics. It must be called
+// after SetupExternalLabels and before any collector is registered.
+func SetupRegistry() error {
+	if p := *internalMetricsPath; p != "" && (p[0] != '/' || p == "/metrics") {
+		return fmt.Errorf("Invalid internal metrics path %q", p)
+	}
+	registry = prometheus.NewRegistry()
+	internalRegistry = registry
+	if *internalMetricsPath != "" {
+		internalRegistry = prometheus.NewRegistry()
+	}
+	registerer = prometheus.WrapRegistererWith(externalLabels, registry)
+	internalRegisterer = prometheus.WrapRegistererWith(externalLabels, internalRegistry)
+	if *disableGoMetrics {
+		return nil
+	}
+	return RegisterInternal(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+// Register registers collectors of availabilities, conflicting metrics are reported as error.
+func Register(collectors ...prometheus.Collector) error {
+	return register(registerer, collectors)
+}
+
+// RegisterInternal registers collectors of metrics about the exporter itself.
+func RegisterInternal(collectors ...prometheus.Collector) error {
+	return register(internalRegisterer, collectors)
+}
+
+func register(r prometheus.Registerer, collectors []prometheus.Collector) error {
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			return fmt.Errorf("Failed to register metrics of %T: %s", c, err)
+		}
+	}
+	return nil
+}
+
+// HandleMetrics registers the handlers of /metrics and the internal metrics path.
+func HandleMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", metricsHandler(registry))
+	if *internalMetricsPath != "" {
+		mux.Handle(*internalMetricsPath, metricsHandler(internalRegistry))
+	}
+}
+
+func metricsHandler(g prometheus.Gatherer) http.Handler {
+	handler := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	if *disableGoMetrics {
+		return handler
+	}
+	// both paths share the handler metrics in the internal registry
+	return promhttp.InstrumentMetricHandler(internalRegisterer, handler)
+}
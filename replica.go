@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var replicaOf = flag.String("replica-of", "", "Base `URL` of another impfe instance to mirror instead of polling Doctolib, e.g. http://impfe.example.com:9091")
+
+// Replica mirrors another instance: it loads the availabilities of its /api/v1/availabilities
+// and applies the events of its /events stream, so the metrics, the API and the dashboard
+// are served as if this instance polled itself. Motives with disabled booking are only
+// known once the other instance reports them on the stream, the opening hours not at all.
+type Replica struct {
+	URL    string
+	client *http.Client
+}
+
+var replica *Replica
+
+// SetupReplica validates --replica-of.
+func SetupReplica() error {
+	if *replicaOf == "" {
+		return nil
+	}
+	u, err := url.Parse(*replicaOf)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid replica URL %q", *replicaOf)
+	}
+	if cluster.Enabled() {
+		return fmt.Errorf("Replica mode does not poll and cannot be combined with clustering")
+	}
+	replica = &Replica{URL: strings.TrimSuffix(*replicaOf, "/"), client: &http.Client{}}
+	return nil
+}
+
+// Run mirrors the other instance into p until ctx is done, reconnecting with backoff.
+func (r *Replica) Run(ctx context.Context, p *Poller) {
+	delay := time.Second
+	for {
+		synced, err := r.sync(ctx, p)
+		if ctx.Err() != nil {
+			return
+		}
+		if synced {
+			delay = time.Second
+		}
+		log.Printf("Replicating %s failed, reconnecting in %s: %s", r.URL, delay, err)
+		select {
+		case <-clock.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// sync subscribes to the stream, loads the availabilities and applies the events until the
+// stream fails. It reports whether the availabilities were loaded.
+func (r *Replica) sync(ctx context.Context, p *Poller) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// subscribe first, the events sent while loading are applied again afterwards
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+"/events", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Subscribing to %s/events failed: %s", r.URL, resp.Status)
+	}
+
+	snap, err := r.load(ctx)
+	if err != nil {
+		return false, err
+	}
+	p.Apply(ctx, snap)
+	log.Printf("Replicating %s: loaded %d centers", r.URL, len(snap.Centers))
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var kind, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if kind != "" && data != "" {
+				if snap, err = ApplyStreamEvent(snap, kind, []byte(data)); err != nil {
+					return true, err
+				}
+				p.Apply(ctx, snap)
+			}
+			kind, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			kind = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, fmt.Errorf("Stream of %s ended", r.URL)
+}
+
+// load fetches the availabilities of the other instance.
+func (r *Replica) load(ctx context.Context) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+"/api/v1/availabilities", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Loading %s/api/v1/availabilities failed: %s", r.URL, resp.Status)
+	}
+	var availabilities AvailabilitiesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&availabilities); err != nil {
+		return nil, fmt.Errorf("Failed to parse availabilities of %s: %s", r.URL, err)
+	}
+	return SnapshotFromAPI(availabilities), nil
+}
+
+// SnapshotFromAPI rebuilds a snapshot from the response of /api/v1/availabilities.
+func SnapshotFromAPI(resp AvailabilitiesResponse) *Snapshot {
+	snap := &Snapshot{Time: resp.Time}
+	for _, c := range resp.Centers {
+		center := doctolib.Impfzentrum{ID: c.PracticeID, Name: c.Name, BookingPage: c.BookingPage, Zipcode: c.Zipcode, City: c.City,
+			Vaccination: map[int]string{}, DisabledVaccination: map[int]string{}, Channels: map[int]string{}}
+		for _, a := range c.Availabilities {
+			center.Vaccination[a.MotiveID] = a.Motive
+			center.Channels[a.MotiveID] = a.Channel
+		}
+		snap.Centers = append(snap.Centers, center)
+		for _, a := range c.Availabilities {
+			o := Observation{Center: center, MotiveID: a.MotiveID, Motive: a.Motive, Insurance: a.Insurance, Slots: a.Slots, FutureVaccinations: a.FutureVaccinations}
+			if day, err := time.ParseInLocation("2006-01-02", a.NextSlot, location); err == nil {
+				o.NextSlot, o.NextSlotTime = day, day
+			}
+			if a.NextSlotTime != nil {
+				o.NextSlotTime = *a.NextSlotTime
+			}
+			snap.Observations = append(snap.Observations, o)
+		}
+	}
+	snap.hash = snap.Hash()
+	return snap
+}
+
+// ApplyStreamEvent returns a copy of snap with an event of the /events stream applied.
+// Events of unknown kinds are ignored, those of another schema version rejected.
+func ApplyStreamEvent(snap *Snapshot, kind string, data []byte) (*Snapshot, error) {
+	var version struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s event: %s", kind, err)
+	}
+	if version.SchemaVersion != EventSchemaVersion {
+		return nil, fmt.Errorf("Unsupported schema version %d of %s event, want %d", version.SchemaVersion, kind, EventSchemaVersion)
+	}
+	next := *snap
+	next.Centers = append([]doctolib.Impfzentrum(nil), snap.Centers...)
+	next.Observations = append([]Observation(nil), snap.Observations...)
+	switch kind {
+	case StreamSlotsAvailable, StreamSlotsGone, StreamChanged:
+		var e AvailabilityEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s event: %s", kind, err)
+		}
+		center := next.center(centerKey{e.BookingPage, e.PracticeID}, e.Center)
+		center.Vaccination[e.MotiveID] = e.Motive
+		delete(center.DisabledVaccination, e.MotiveID)
+		center.Channels[e.MotiveID] = e.Channel
+		o := Observation{Center: *center, MotiveID: e.MotiveID, Motive: e.Motive, Insurance: e.Insurance, Slots: e.Slots}
+		if day, err := time.ParseInLocation("2006-01-02", e.NextSlot, location); err == nil {
+			o.NextSlot, o.NextSlotTime = day, day
+		}
+		if e.Slot != nil {
+			o.NextSlotTime, o.NextSlotPractice, o.NextSlotAgenda = e.Slot.Start, e.Slot.PracticeID, e.Slot.AgendaID
+		}
+		key := seriesKey{centerKey{e.BookingPage, e.PracticeID}, e.Motive, e.Insurance}
+		found := false
+		for i, prev := range next.Observations {
+			if prev.key() == key {
+				o.FutureVaccinations = prev.FutureVaccinations
+				next.Observations[i] = o
+				found = true
+			}
+		}
+		if !found {
+			next.Observations = append(next.Observations, o)
+		}
+		next.Time, next.Cycle = e.Time, e.Cycle
+	case StreamBookingEnabled, StreamBookingDisabled:
+		var e BookingEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s event: %s", kind, err)
+		}
+		key := centerKey{e.BookingPage, e.PracticeID}
+		center := next.center(key, e.Center)
+		if kind == StreamBookingEnabled {
+			center.Vaccination[e.MotiveID] = e.Motive
+			delete(center.DisabledVaccination, e.MotiveID)
+		} else {
+			center.DisabledVaccination[e.MotiveID] = e.Motive
+			delete(center.Vaccination, e.MotiveID)
+			// motives with disabled booking are not polled
+			kept := next.Observations[:0]
+			for _, o := range next.Observations {
+				if keyOfCenter(o.Center) != key || o.MotiveID != e.MotiveID {
+					kept = append(kept, o)
+				}
+			}
+			next.Observations = kept
+		}
+		next.Time, next.Cycle = e.Time, e.Cycle
+	case StreamCenterRenamed:
+		var e CenterRenamedEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s event: %s", kind, err)
+		}
+		next.center(centerKey{e.BookingPage, e.PracticeID}, e.Center).Name = e.Center
+		next.Time, next.Cycle = e.Time, e.Cycle
+	default:
+		return snap, nil
+	}
+	// the observations carry a copy of their center
+	centers := map[centerKey]doctolib.Impfzentrum{}
+	for _, c := range next.Centers {
+		centers[keyOfCenter(c)] = c
+	}
+	for i, o := range next.Observations {
+		if c, ok := centers[keyOfCenter(o.Center)]; ok {
+			next.Observations[i].Center = c
+		}
+	}
+	next.hash = next.Hash()
+	return &next, nil
+}
+
+// center returns a copy of the center of a snapshot copy which may be modified, adding the
+// center if it is missing.
+func (s *Snapshot) center(key centerKey, name string) *doctolib.Impfzentrum {
+	for i, c := range s.Centers {
+		if keyOfCenter(c) != key {
+			continue
+		}
+		copied := c
+		copied.Vaccination, copied.DisabledVaccination, copied.Channels = copyMotives(c.Vaccination), copyMotives(c.DisabledVaccination), copyMotives(c.Channels)
+		s.Centers[i] = copied
+		return &s.Centers[i]
+	}
+	s.Centers = append(s.Centers, doctolib.Impfzentrum{ID: key.id, Name: name, BookingPage: key.bookingPage,
+		Vaccination: map[int]string{}, DisabledVaccination: map[int]string{}, Channels: map[int]string{}})
+	return &s.Centers[len(s.Centers)-1]
+}
+
+func copyMotives(m map[int]string) map[int]string {
+	copied := make(map[int]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
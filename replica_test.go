@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+func TestReplicaMirrorsStream(t *testing.T) {
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	day := Day(now).AddDate(0, 0, 2)
+	tegel := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel", BookingPage: "ciz-berlin-berlin", Vaccination: map[int]string{7: "Erstimpfung", 8: "Zweitimpfung"}}
+	central := &Snapshot{Time: now, Centers: []doctolib.Impfzentrum{tegel}, Observations: []Observation{
+		{Center: tegel, MotiveID: 7, Motive: "Erstimpfung", FutureVaccinations: 12},
+		{Center: tegel, MotiveID: 8, Motive: "Zweitimpfung", Slots: 2, NextSlot: day, NextSlotTime: day.Add(9 * time.Hour)},
+	}}
+	changed := central.Observations[0]
+	changed.Slots, changed.NextSlot, changed.NextSlotTime = 3, day, day
+	renamed := CenterRenamedEvent{SchemaVersion: EventSchemaVersion, Time: now, BookingPage: tegel.BookingPage, PracticeID: 1, Center: "Tegel", Previous: tegel.Name}
+	events := []StreamEvent{
+		{StreamSlotsAvailable, NewAvailabilityEvent(changed, now.Add(time.Minute))},
+		{StreamBookingDisabled, BookingEvent{SchemaVersion: EventSchemaVersion, Time: now, BookingPage: tegel.BookingPage, PracticeID: 1, MotiveID: 8, Motive: "Zweitimpfung"}},
+		{StreamCenterRenamed, renamed},
+		{"unknown", renamed},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/availabilities", &APIHandler{snapshot: func() *Snapshot { return central }})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keepalive\n\n")
+		for _, e := range events {
+			data, _ := json.Marshal(e.Data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := &Poller{}
+	r := &Replica{URL: srv.URL, client: srv.Client()}
+	if synced, err := r.sync(context.Background(), p); !synced {
+		t.Fatalf("Replica did not load the availabilities: %s", err)
+	}
+	snap := p.Snapshot()
+	if len(snap.Observations) != 1 {
+		t.Fatalf("replica has %d observations, want the one of the motive with enabled booking: %+v", len(snap.Observations), snap.Observations)
+	}
+	o := snap.Observations[0]
+	if o.Slots != 3 || !o.NextSlot.Equal(day) || o.FutureVaccinations != 12 || o.Center.Name != "Tegel" {
+		t.Errorf("replicated observation = %+v, want 3 slots on %s of the renamed center", o, day)
+	}
+	if disabled := snap.Centers[0].DisabledVaccination; disabled[8] != "Zweitimpfung" {
+		t.Errorf("disabled motives = %v, want Zweitimpfung", disabled)
+	}
+	enabled := BookingEvent{SchemaVersion: EventSchemaVersion, Time: now, BookingPage: tegel.BookingPage, PracticeID: 1, MotiveID: 8, Motive: "Zweitimpfung"}
+	data, _ := json.Marshal(enabled)
+	if _, err := ApplyStreamEvent(snap, StreamBookingEnabled, data); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Centers[0].Vaccination) != 1 {
+		t.Error("applying an event modified the previous snapshot")
+	}
+
+	if _, err := ApplyStreamEvent(snap, StreamChanged, []byte(`{"schema_version":2}`)); err == nil {
+		t.Error("event of another schema version applied")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var requestLogSize = flag.Int("request-log-size", 500, "Number of recent upstream requests kept for /debug/requests")
+
+// RequestRecord describes one upstream request.
+type RequestRecord struct {
+	Time       time.Time     `json:"time"`
+	URL        string        `json:"url"`
+	Status     int           `json:"status,omitempty"`
+	Latency    time.Duration `json:"latency_ns"`
+	ErrorClass string        `json:"error_class,omitempty"`
+	Bytes      int           `json:"bytes"`
+}
+
+// ErrorClass classifies the outcome of an upstream request, empty if it succeeded.
+func ErrorClass(status int, err error) string {
+	var netErr net.Error
+	switch {
+	case err != nil && errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case err != nil:
+		return "network"
+	case IsBlocked(status):
+		return "blocked"
+	case status >= 500:
+		return "server_error"
+	case status >= 400:
+		return "client_error"
+	}
+	return ""
+}
+
+// RequestLog is a ring buffer of the most recent upstream requests.
+type RequestLog struct {
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+}
+
+var requestLog = &RequestLog{}
+
+// Add records a request, replacing the oldest one if the buffer is full.
+func (l *RequestLog) Add(r RequestRecord) {
+	if *requestLogSize <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < *requestLogSize {
+		l.records = append(l.records, r)
+		return
+	}
+	l.records[l.next] = r
+	l.next = (l.next + 1) % len(l.records)
+}
+
+// Records returns the recorded requests, oldest first.
+func (l *RequestLog) Records() []RequestRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make([]RequestRecord, 0, len(l.records))
+	result = append(result, l.records[l.next:]...)
+	return append(result, l.records[:l.next]...)
+}
+
+// ServeHTTP renders the recorded requests as a table, or as JSON with ?format=json.
+func (l *RequestLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	records := l.Records()
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="requests.json"`)
+		json.NewEncoder(w).Encode(records)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSTATUS\tLATENCY\tBYTES\tERROR\tURL")
+	for _, rec := range records {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t%s\n", rec.Time.Format(time.RFC3339), rec.Status, rec.Latency.Round(time.Millisecond), rec.Bytes, rec.ErrorClass, rec.URL)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"sort"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+var (
+	retryMaxAttempts = flag.Int("retry-max-attempts", 3, "Maximum attempts per Doctolib call, 1 disables retries")
+	retryBaseDelay   = flag.Duration("retry-base-delay", 1*time.Second, "Delay before the first retry of a Doctolib call, doubled for every further attempt")
+	retryMaxDelay    = flag.Duration("retry-max-delay", 30*time.Second, "Maximum delay between retries of a Doctolib call")
+)
+
+// RetryPolicy configures retries and timeouts of calls to one external integration.
+type RetryPolicy struct {
+	MaxAttempts int           `yaml:"max-attempts"`
+	BaseDelay   time.Duration `yaml:"base-delay"`
+	MaxDelay    time.Duration `yaml:"max-delay"`
+	// Timeout of a single attempt, zero keeps the default of the integration.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks the policy of the named integration.
+func (p RetryPolicy) Validate(name string) error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("Retry policy %s: max-attempts must be at least 1, got %d", name, p.MaxAttempts)
+	case p.BaseDelay < 0 || p.MaxDelay < 0 || p.Timeout < 0:
+		return fmt.Errorf("Retry policy %s: durations must not be negative", name)
+	case p.BaseDelay > p.MaxDelay:
+		return fmt.Errorf("Retry policy %s: base-delay %s exceeds max-delay %s", name, p.BaseDelay, p.MaxDelay)
+	}
+	return nil
+}
+
+// merge overrides the fields of p which are set in o.
+func (p RetryPolicy) merge(o RetryPolicy) RetryPolicy {
+	if o.MaxAttempts != 0 {
+		p.MaxAttempts = o.MaxAttempts
+	}
+	if o.BaseDelay != 0 {
+		p.BaseDelay = o.BaseDelay
+	}
+	if o.MaxDelay != 0 {
+		p.MaxDelay = o.MaxDelay
+	}
+	if o.Timeout != 0 {
+		p.Timeout = o.Timeout
+	}
+	return p
+}
+
+// defaultRetryPolicies are the built-in policies per integration, configurable
+// in the retry section of the config file.
+var defaultRetryPolicies = map[string]RetryPolicy{
+	"doctolib": {MaxAttempts: 3, BaseDelay: 1 * time.Second, MaxDelay: 30 * time.Second},
+	"telegram": {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+	"slack":    {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+	"discord":  {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+	"ntfy":     {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+	"gotify":   {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+	"smtp":     {MaxAttempts: 3, BaseDelay: 5 * time.Second, MaxDelay: time.Minute, Timeout: 30 * time.Second},
+	"webhook":  {MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Timeout: 10 * time.Second},
+}
+
+// retryPolicies are the resolved policies per integration.
+var retryPolicies = map[string]RetryPolicy{}
+
+// ResolveRetryPolicies merges the retry section of the config file onto the defaults.
+// For Doctolib the retry flags take precedence when given on the command line or environment.
+func ResolveRetryPolicies() error {
+	names := make([]string, 0, len(config.Retry))
+	for name := range config.Retry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := defaultRetryPolicies[name]; !ok {
+			return fmt.Errorf("Unknown integration %q in retry section of config %s", name, configName())
+		}
+	}
+
+	policies := map[string]RetryPolicy{}
+	for name, p := range defaultRetryPolicies {
+		policies[name] = p.merge(config.Retry[name])
+	}
+	doctolibPolicy := policies["doctolib"]
+	for flagName, set := range map[string]func(){
+		"retry-max-attempts": func() { doctolibPolicy.MaxAttempts = *retryMaxAttempts },
+		"retry-base-delay":   func() { doctolibPolicy.BaseDelay = *retryBaseDelay },
+		"retry-max-delay":    func() { doctolibPolicy.MaxDelay = *retryMaxDelay },
+	} {
+		if s := flagSources[flagName]; s != "" && s != "default" {
+			set()
+		}
+	}
+	policies["doctolib"] = doctolibPolicy
+
+	for name, p := range policies {
+		if err := p.Validate(name); err != nil {
+			return err
+		}
+	}
+	retryPolicies = policies
+	return nil
+}
+
+// retrySource retries transient failures of the wrapped source with exponential backoff.
+type retrySource struct {
+	Source
+	policy RetryPolicy
+}
+
+func (s retrySource) Impfzentren(ctx context.Context, bookingPage string) (centers []doctolib.Impfzentrum, err error) {
+	err = Retry(ctx, s.policy, func() error {
+		centers, err = s.Source.Impfzentren(ctx, bookingPage)
+		return err
+	})
+	return centers, err
+}
+
+func (s retrySource) Search(ctx context.Context, speciality, place string, page int) (r *doctolib.SearchResponse, err error) {
+	err = Retry(ctx, s.policy, func() error {
+		r, err = s.Source.Search(ctx, speciality, place, page)
+		return err
+	})
+	return r, err
+}
+
+func (s retrySource) GetAvailabilities(ctx context.Context, practice int, motive int, agendaIDs []int) (r *doctolib.AvailbilitiesResponse, err error) {
+	err = Retry(ctx, s.policy, func() error {
+		r, err = s.Source.GetAvailabilities(ctx, practice, motive, agendaIDs)
+		return err
+	})
+	return r, err
+}
+
+// Retry calls f until it succeeds, fails permanently or the attempts of the policy are used up.
+func Retry(ctx context.Context, policy RetryPolicy, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f(); err == nil || attempt >= policy.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := policy.Backoff(attempt)
+		log.Printf("Attempt %d failed, retrying in %s: %s", attempt, delay, err)
+		select {
+		case <-clock.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Backoff returns the delay after the given failed attempt: exponential, jittered between half and the full delay.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsTransient reports whether err is worth retrying: server errors and network failures.
+// Blocked Doctolib requests are not retried to not dig the hole deeper.
+func IsTransient(err error) bool {
+	var statusErr *doctolib.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	var notifyErr *HTTPStatusError
+	if errors.As(err, &notifyErr) {
+		return notifyErr.Temporary()
+	}
+	// SMTP replies 4xx on temporary failures like greylisting
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF)
+}
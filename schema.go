@@ -0,0 +1,88 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// EventSchemaVersion is the schema_version of the events posted to webhooks and sent on
+// /events. It is incremented on incompatible changes, e.g. removed or retyped fields, but
+// not for new optional fields, so integrations can reject events they do not understand.
+const EventSchemaVersion = 1
+
+// schemaFiles are the JSON Schema files of the events, served at /api/v1/schema/<name>.json.
+//
+//go:embed schema/*.json
+var schemaFiles embed.FS
+
+// SchemaIndex is the body of /api/v1/schema.
+type SchemaIndex struct {
+	SchemaVersion int         `json:"schema_version"`
+	Schemas       []SchemaRef `json:"schemas"`
+}
+
+// SchemaRef describes a schema file.
+type SchemaRef struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// SchemaHandler serves the index of the event schemas and the schema files.
+type SchemaHandler struct{}
+
+func (SchemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/schema"), "/")
+	if name == "" {
+		index, err := NewSchemaIndex()
+		if err != nil {
+			http.Error(w, "reading schemas failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(index)
+		return
+	}
+	data, err := schemaFiles.ReadFile(path.Join("schema", path.Base(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
+
+// NewSchemaIndex lists the embedded schema files.
+func NewSchemaIndex() (SchemaIndex, error) {
+	index := SchemaIndex{SchemaVersion: EventSchemaVersion}
+	entries, err := schemaFiles.ReadDir("schema")
+	if err != nil {
+		return index, err
+	}
+	for _, e := range entries {
+		data, err := schemaFiles.ReadFile(path.Join("schema", e.Name()))
+		if err != nil {
+			return index, err
+		}
+		var schema struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return index, err
+		}
+		index.Schemas = append(index.Schemas, SchemaRef{
+			Name:        strings.TrimSuffix(e.Name(), ".json"),
+			Title:       schema.Title,
+			Description: schema.Description,
+			URL:         "/api/v1/schema/" + e.Name(),
+		})
+	}
+	sort.Slice(index.Schemas, func(i, j int) bool { return index.Schemas[i].Name < index.Schemas[j].Name })
+	return index, nil
+}
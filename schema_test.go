@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// schemaObject is the subset of JSON Schema used by the schema files.
+type schemaObject struct {
+	Properties           map[string]*schemaObject `json:"properties"`
+	Required             []string                 `json:"required"`
+	AdditionalProperties *bool                    `json:"additionalProperties"`
+	Const                interface{}              `json:"const"`
+}
+
+// checkSchema reports the fields of v missing from or not allowed by the schema.
+func checkSchema(t *testing.T, name string, s *schemaObject, v interface{}) {
+	t.Helper()
+	if s.Const != nil && s.Const != v {
+		t.Errorf("%s = %v, want %v", name, v, s.Const)
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok || s.Properties == nil {
+		return
+	}
+	for _, field := range s.Required {
+		if _, ok := obj[field]; !ok {
+			t.Errorf("%s lacks the required field %s", name, field)
+		}
+	}
+	for field, value := range obj {
+		p, ok := s.Properties[field]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				t.Errorf("%s has the field %s missing from its schema", name, field)
+			}
+			continue
+		}
+		checkSchema(t, name+"."+field, p, value)
+	}
+}
+
+func TestEventsMatchSchemas(t *testing.T) {
+	now := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	day := Day(now).AddDate(0, 0, 2)
+	center := doctolib.Impfzentrum{ID: 1, Name: "Impfzentrum Tegel", BookingPage: "ciz-berlin-berlin"}
+	event := NewAvailabilityEvent(Observation{Center: center, MotiveID: 7, Motive: "Erstimpfung Moderna", Slots: 3, NextSlot: day, NextSlotTime: day.Add(9 * time.Hour), NextSlotPractice: 1, NextSlotAgenda: 5}, now)
+	event.Cycle = "c1"
+	previous := Observation{Slots: 1, NextSlot: day.AddDate(0, 0, 1)}
+	payload := NewWebhookPayload(Notification{Event: event, Link: "https://www.doctolib.de/", NewSlots: true, Alert: true, Confidence: ConfidenceConfirmed, Previous: &previous})
+
+	for name, v := range map[string]interface{}{
+		"availability-event":   event,
+		"webhook-payload":      payload,
+		"webhook-broadcast":    WebhookBroadcast{SchemaVersion: EventSchemaVersion, Broadcast: WebhookAnnouncement{Time: now, Title: "Wartung", Text: "Heute abend"}},
+		"booking-event":        BookingEvent{SchemaVersion: EventSchemaVersion, Time: now, Center: center.Name, BookingPage: center.BookingPage, PracticeID: 1, MotiveID: 7, Motive: "Erstimpfung", Cycle: "c1"},
+		"center-renamed-event": CenterRenamedEvent{SchemaVersion: EventSchemaVersion, Time: now, BookingPage: center.BookingPage, PracticeID: 1, Center: center.Name, Previous: "Tegel", Cycle: "c1"},
+	} {
+		data, err := schemaFiles.ReadFile("schema/" + name + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s schemaObject
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("Invalid schema %s: %s", name, err)
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded interface{}
+		json.Unmarshal(encoded, &decoded)
+		if version := decoded.(map[string]interface{})["schema_version"]; version != float64(EventSchemaVersion) {
+			t.Errorf("%s has schema_version %v, want %d", name, version, EventSchemaVersion)
+		}
+		checkSchema(t, name, &s, decoded)
+	}
+}
+
+func TestSchemaHandler(t *testing.T) {
+	for path, code := range map[string]int{
+		"/api/v1/schema":                          http.StatusOK,
+		"/api/v1/schema/webhook-payload.json":     http.StatusOK,
+		"/api/v1/schema/missing.json":             http.StatusNotFound,
+		"/api/v1/schema/../../../etc/passwd.json": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		SchemaHandler{}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != code {
+			t.Errorf("GET %s answered %d, want %d", path, w.Code, code)
+		}
+	}
+	index, err := NewSchemaIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Schemas) != 6 || index.SchemaVersion != EventSchemaVersion {
+		t.Errorf("index = %+v, want the 6 schemas of version %d", index, EventSchemaVersion)
+	}
+}
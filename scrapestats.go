@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeKey identifies a scraped booking page, or a center on it if id is set.
+type scrapeKey struct {
+	bookingPage string
+	id          int
+}
+
+type scrapeStat struct {
+	// name is the latest name of the center
+	name        string
+	errors      uint64
+	duration    time.Duration
+	lastSuccess time.Time
+}
+
+// ScrapeStats tracks the outcome of the upstream requests per booking page and
+// center, so failures of the exporter itself can be alerted on.
+type ScrapeStats struct {
+	mu      sync.Mutex
+	stats   map[scrapeKey]*scrapeStat
+	orphans map[string]uint64
+
+	errorsDesc      *prometheus.Desc
+	durationDesc    *prometheus.Desc
+	lastSuccessDesc *prometheus.Desc
+	orphansDesc     *prometheus.Desc
+}
+
+var scrapeStats = &ScrapeStats{stats: map[scrapeKey]*scrapeStat{}, orphans: map[string]uint64{}}
+
+// OrphanAgenda counts an agenda of a booking page referencing an unknown practice.
+func (s *ScrapeStats) OrphanAgenda(bookingPage string, agendaID, practiceID int) {
+	log.Printf("Skipping agenda %d of %s referencing unknown practice %d", agendaID, bookingPage, practiceID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orphans[bookingPage]++
+}
+
+// Observe records a request for a booking page, or for a center if it is not nil, which started at start.
+func (s *ScrapeStats) Observe(bookingPage string, center *doctolib.Impfzentrum, start time.Time, err error) {
+	now := clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := scrapeKey{bookingPage: bookingPage}
+	if center != nil {
+		key.id = center.ID
+	}
+	st, ok := s.stats[key]
+	if !ok {
+		st = &scrapeStat{}
+		s.stats[key] = st
+	}
+	if center != nil {
+		st.name = center.Name
+	}
+	st.duration = now.Sub(start)
+	if err != nil {
+		st.errors++
+	} else {
+		st.lastSuccess = now
+	}
+}
+
+// Forget drops the stats of a center.
+func (s *ScrapeStats) Forget(bookingPage string, id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.stats, scrapeKey{bookingPage, id})
+}
+
+func (s *ScrapeStats) Describe(ch chan<- *prometheus.Desc) {
+	if s.errorsDesc == nil {
+		labels := []string{"booking_page", "name", "id"}
+		s.errorsDesc = prometheus.NewDesc("impfe_scrape_errors_total",
+			"Fehlgeschlagene Abfragen je Buchungsseite und Impfzentrum",
+			labels, nil,
+		)
+		s.durationDesc = prometheus.NewDesc("impfe_scrape_duration_seconds",
+			"Dauer der letzten Abfrage je Buchungsseite und Impfzentrum",
+			labels, nil,
+		)
+		s.lastSuccessDesc = prometheus.NewDesc("impfe_last_successful_scrape_timestamp_seconds",
+			"Zeitpunkt der letzten erfolgreichen Abfrage je Buchungsseite und Impfzentrum",
+			labels, nil,
+		)
+		s.orphansDesc = prometheus.NewDesc("impfe_orphan_agendas_total",
+			"Uebersprungene Kalender, die auf eine unbekannte Praxis verweisen",
+			[]string{"booking_page"}, nil,
+		)
+	}
+	ch <- s.orphansDesc
+	ch <- s.errorsDesc
+	ch <- s.durationDesc
+	ch <- s.lastSuccessDesc
+}
+
+func (s *ScrapeStats) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for page, n := range s.orphans {
+		ch <- prometheus.MustNewConstMetric(s.orphansDesc, prometheus.CounterValue, float64(n), page)
+	}
+	for key, st := range s.stats {
+		name := NormalizeLabelValue(st.name)
+		id := ""
+		if key.id != 0 {
+			id = strconv.Itoa(key.id)
+		}
+		ch <- prometheus.MustNewConstMetric(s.errorsDesc, prometheus.CounterValue, float64(st.errors), key.bookingPage, name, id)
+		ch <- prometheus.MustNewConstMetric(s.durationDesc, prometheus.GaugeValue, st.duration.Seconds(), key.bookingPage, name, id)
+		if !st.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(s.lastSuccessDesc, prometheus.GaugeValue, float64(st.lastSuccess.UnixNano())/1e9, key.bookingPage, name, id)
+		}
+	}
+}
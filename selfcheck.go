@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Check results of the self check.
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// CheckResult is the outcome of one self check.
+type CheckResult struct {
+	Category string        `json:"category"`
+	Name     string        `json:"name"`
+	Result   string        `json:"result"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// SelfCheckReport is the machine readable report of the self check.
+type SelfCheckReport struct {
+	Time    time.Time     `json:"time"`
+	Passed  bool          `json:"passed"`
+	Results []CheckResult `json:"results"`
+}
+
+// SelfCheck verifies that a deployment works: upstream connectivity, parsing of
+// the responses, writable storage and the notifiers.
+func SelfCheck(ctx context.Context) *SelfCheckReport {
+	report := &SelfCheckReport{Time: clock.Now(), Passed: true}
+	add := func(category, name string, start time.Time, err error, skip string) {
+		r := CheckResult{Category: category, Name: name, Result: CheckPass, Duration: clock.Now().Sub(start)}
+		switch {
+		case skip != "":
+			r.Result, r.Message = CheckSkip, skip
+		case err != nil:
+			r.Result, r.Message = CheckFail, err.Error()
+			report.Passed = false
+		}
+		report.Results = append(report.Results, r)
+	}
+
+	for _, page := range BookingPages() {
+		start := clock.Now()
+		centers, err := source.Impfzentren(ctx, page)
+		add("connectivity", "booking page "+page, start, err, "")
+		if err != nil {
+			continue
+		}
+		// parse canary: the first bookable motive must return a parseable availability
+		start = clock.Now()
+		err = fmt.Errorf("No bookable vaccination found")
+		for _, c := range centers {
+			ids := sortedMotiveIDs(c.Vaccination)
+			if len(ids) == 0 {
+				continue
+			}
+			cycleCtx, logger := NewCycle(ctx)
+			if _, ok := FetchAvailability(cycleCtx, logger, c, ids[0], c.Vaccination[ids[0]]); ok {
+				err = nil
+			} else {
+				err = fmt.Errorf("Availabilities of %s could not be fetched or parsed", c.Name)
+			}
+			break
+		}
+		add("parse", "availabilities "+page, start, err, "")
+	}
+
+	add("auth", "doctolib session", clock.Now(), nil, "No authentication configured")
+
+	storage := map[string]string{}
+	if *crawlStateFile != "" {
+		storage["crawl state"] = filepath.Dir(*crawlStateFile)
+	}
+	if cluster.Dir != "" {
+		storage["cluster directory"] = cluster.Dir
+	}
+	names := make([]string, 0, len(storage))
+	for name := range storage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		start := clock.Now()
+		add("storage", name, start, checkWritable(storage[name]), "")
+	}
+	if backupStore != nil {
+		start := clock.Now()
+		_, err := backupStore.List(ctx, *backupPrefix)
+		add("storage", "backup bucket "+*backupBucket, start, err, "")
+	}
+	if len(storage) == 0 && backupStore == nil {
+		add("storage", "state", clock.Now(), nil, "No persistent storage configured")
+	}
+
+	for _, n := range notifiers {
+		start := clock.Now()
+		if d, ok := n.(DryRunner); ok {
+			add("notifier", n.Name(), start, d.DryRun(ctx), "")
+		} else {
+			add("notifier", n.Name(), start, nil, "No dry run supported")
+		}
+	}
+	if len(notifiers) == 0 {
+		add("notifier", "dry run", clock.Now(), nil, "No notifiers configured")
+	}
+	return report
+}
+
+// checkWritable verifies that files can be created in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".impfe-selfcheck-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// RunSelfCheck writes the self check report to w in the given format (text, json)
+// and fails if any check failed.
+func RunSelfCheck(ctx context.Context, w io.Writer, format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("Unknown format %q", format)
+	}
+	report := SelfCheck(ctx)
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CATEGORY\tCHECK\tRESULT\tDURATION\tMESSAGE")
+		for _, r := range report.Results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Category, r.Name, r.Result, r.Duration.Round(time.Millisecond), r.Message)
+		}
+		tw.Flush()
+	}
+	if !report.Passed {
+		return fmt.Errorf("Self check failed")
+	}
+	return nil
+}
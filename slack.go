@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SlackConfig configures a Slack incoming webhook.
+type SlackConfig struct {
+	WebhookURL string          `yaml:"webhook_url"`
+	Template   MessageTemplate `yaml:"template"`
+	Selection  `yaml:",inline"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Pool spreads the notifications over the notifiers of the backend with the same pool, see NotifierPool.
+	Pool string `yaml:"pool"`
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	selector
+	url    string
+	format messageFormat
+	client *http.Client
+}
+
+// NewSlackNotifier validates the config and returns the notifier.
+func NewSlackNotifier(c SlackConfig) (*SlackNotifier, error) {
+	if !strings.HasPrefix(c.WebhookURL, "https://") {
+		return nil, fmt.Errorf("Slack notifier needs a https webhook_url")
+	}
+	sel, err := newSelector(c.Selection)
+	if err != nil {
+		return nil, err
+	}
+	format, err := newMessageFormat(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &SlackNotifier{selector: sel, url: c.WebhookURL, format: format, client: notifierHTTPClient("slack")}, nil
+}
+
+func (s *SlackNotifier) Name() string { return "slack" }
+
+// slackMaxMembers keeps combined messages below the limit of 50 blocks per message.
+const slackMaxMembers = 20
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	if s.format.custom() {
+		return postJSON(ctx, s.client, s.url, map[string]string{"text": s.format.Text(n)})
+	}
+	var blocks []map[string]interface{}
+	if len(n.Group) > 1 {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "header",
+			"text": map[string]string{"type": "plain_text", "text": n.Title()},
+		})
+	}
+	members := n.Members()
+	if len(members) > slackMaxMembers {
+		members = members[:slackMaxMembers]
+	}
+	for _, m := range members {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*<%s|%s>*\n%s", m.Link, slackEscape(m.Event.Center), slackEscape(m.Event.Motive)),
+			},
+		}, map[string]interface{}{
+			"type": "section",
+			"fields": []map[string]string{
+				{"type": "mrkdwn", "text": "*Naechster Termin*\n" + nextSlotText(m)},
+				{"type": "mrkdwn", "text": fmt.Sprintf("*Freie Termine*\n%d", m.Event.Slots)},
+			},
+		})
+	}
+	if more := len(n.Members()) - len(members); more > 0 {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"elements": []map[string]string{{"type": "mrkdwn", "text": fmt.Sprintf("und %d weitere", more)}},
+		})
+	}
+	// the text is the fallback for clients not rendering blocks
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"text":   n.Text(),
+		"blocks": blocks,
+	})
+}
+
+func (s *SlackNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"text": "*" + slackEscape(title) + "*\n" + slackEscape(text)})
+}
+
+// slackEscape escapes the control characters of Slack's mrkdwn.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
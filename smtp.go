@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig configures the delivery of notifications by email.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	// TLS is starttls (default), tls for implicit TLS, usually on port 465, or none.
+	TLS string `yaml:"tls"`
+	// Subject and Body are Go templates like the title and text of MessageTemplate.
+	Subject    string          `yaml:"subject"`
+	Body       string          `yaml:"body"`
+	Recipients []SMTPRecipient `yaml:"recipients"`
+}
+
+// SMTPRecipient is an email address together with the notifications it receives.
+type SMTPRecipient struct {
+	Address   string `yaml:"address"`
+	Selection `yaml:",inline"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+}
+
+// smtpServer is the validated server part of the config shared by all recipients.
+type smtpServer struct {
+	config SMTPConfig
+	format messageFormat
+}
+
+// SMTPNotifier sends notifications by email to one recipient.
+type SMTPNotifier struct {
+	selector
+	server *smtpServer
+	to     string
+}
+
+// NewSMTPNotifiers validates the config and returns a notifier per recipient.
+func NewSMTPNotifiers(c SMTPConfig) ([]*SMTPNotifier, error) {
+	if c.Host == "" || c.From == "" || len(c.Recipients) == 0 {
+		return nil, fmt.Errorf("SMTP notifier needs host, from and recipients")
+	}
+	switch c.TLS {
+	case "":
+		c.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("Unknown SMTP TLS mode %q, use starttls, tls or none", c.TLS)
+	}
+	if c.Port == 0 {
+		c.Port = 587
+		if c.TLS == "tls" {
+			c.Port = 465
+		}
+	}
+	format, err := newMessageFormat(MessageTemplate{Title: c.Subject, Text: c.Body})
+	if err != nil {
+		return nil, err
+	}
+	s := &smtpServer{config: c, format: format}
+	var result []*SMTPNotifier
+	for _, r := range c.Recipients {
+		if !strings.Contains(r.Address, "@") {
+			return nil, fmt.Errorf("Invalid SMTP recipient %q", r.Address)
+		}
+		sel, err := newSelector(r.Selection)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &SMTPNotifier{selector: sel, server: s, to: r.Address})
+	}
+	return result, nil
+}
+
+func (s *SMTPNotifier) Name() string { return "smtp" }
+
+// DryRun connects and authenticates without sending a mail.
+func (s *SMTPNotifier) DryRun(ctx context.Context) error {
+	c, err := s.server.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	return s.send(ctx, s.server.format.Title(n), s.server.format.Text(n))
+}
+
+func (s *SMTPNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return s.send(ctx, title, text)
+}
+
+// send mails a message to the recipient.
+func (s *SMTPNotifier) send(ctx context.Context, subject, body string) error {
+	msg, err := s.server.message(s.to, subject, body)
+	if err != nil {
+		return err
+	}
+	c, err := s.server.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Mail(s.server.config.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(s.to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dial connects to the server, negotiates TLS and authenticates.
+func (s *smtpServer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Timeout: retryPolicies["smtp"].Timeout}
+	var conn net.Conn
+	var err error
+	if s.config.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.config.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if t := retryPolicies["smtp"].Timeout; t > 0 {
+		conn.SetDeadline(time.Now().Add(t))
+	}
+	c, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if s.config.TLS == "starttls" {
+		if err := c.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// message renders a mail.
+func (s *smtpServer) message(to, subject, body string) ([]byte, error) {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", clock.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body+"\n", "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
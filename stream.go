@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of stream events.
+const (
+	StreamSlotsAvailable  = "slots_available"
+	StreamSlotsGone       = "slots_gone"
+	StreamChanged         = "changed"
+	StreamBookingEnabled  = "booking_enabled"
+	StreamBookingDisabled = "booking_disabled"
+	StreamCenterRenamed   = "center_renamed"
+)
+
+// StreamEvent is an event of the /events stream.
+type StreamEvent struct {
+	Kind string
+	// Data is sent JSON encoded.
+	Data interface{}
+}
+
+// BookingEvent reports that booking of a vaccination type at a center got enabled or disabled.
+type BookingEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Center        string    `json:"center"`
+	BookingPage   string    `json:"booking_page"`
+	PracticeID    int       `json:"practice_id"`
+	MotiveID      int       `json:"motive_id"`
+	Motive        string    `json:"motive"`
+	Cycle         string    `json:"cycle,omitempty"`
+}
+
+// StreamEvents returns the events between the snapshots prev and snap, nothing for the first poll.
+func StreamEvents(prev, snap *Snapshot) []StreamEvent {
+	if prev == nil {
+		return nil
+	}
+	previous := map[seriesKey]Observation{}
+	for _, o := range prev.Observations {
+		previous[o.key()] = o
+	}
+	var events []StreamEvent
+	for _, e := range Events(prev, snap) {
+		kind := StreamChanged
+		if p, ok := previous[e.key()]; ok && p.Slots == 0 && e.Slots > 0 {
+			kind = StreamSlotsAvailable
+		} else if ok && p.Slots > 0 && e.Slots == 0 {
+			kind = StreamSlotsGone
+		}
+		events = append(events, StreamEvent{kind, e})
+	}
+	enabled := func(s *Snapshot) map[seriesKey]BookingEvent {
+		m := map[seriesKey]BookingEvent{}
+		for _, c := range s.Centers {
+			for id, name := range c.Vaccination {
+				m[seriesKey{center: keyOfCenter(c), motive: name}] = BookingEvent{SchemaVersion: EventSchemaVersion, Time: snap.Time, Center: c.Name, BookingPage: c.BookingPage, PracticeID: c.ID, MotiveID: id, Motive: name, Cycle: snap.Cycle}
+			}
+		}
+		return m
+	}
+	disabled := func(s *Snapshot) map[seriesKey]BookingEvent {
+		m := map[seriesKey]BookingEvent{}
+		for _, c := range s.Centers {
+			for id, name := range c.DisabledVaccination {
+				m[seriesKey{center: keyOfCenter(c), motive: name}] = BookingEvent{SchemaVersion: EventSchemaVersion, Time: snap.Time, Center: c.Name, BookingPage: c.BookingPage, PracticeID: c.ID, MotiveID: id, Motive: name, Cycle: snap.Cycle}
+			}
+		}
+		return m
+	}
+	wasDisabled, nowEnabled := disabled(prev), enabled(snap)
+	wasEnabled, nowDisabled := enabled(prev), disabled(snap)
+	var booking []StreamEvent
+	for key, e := range nowEnabled {
+		if _, ok := wasDisabled[key]; ok {
+			booking = append(booking, StreamEvent{StreamBookingEnabled, e})
+		}
+	}
+	for key, e := range nowDisabled {
+		if _, ok := wasEnabled[key]; ok {
+			booking = append(booking, StreamEvent{StreamBookingDisabled, e})
+		}
+	}
+	sort.Slice(booking, func(i, j int) bool {
+		a, b := booking[i].Data.(BookingEvent), booking[j].Data.(BookingEvent)
+		return a.Center+a.Motive < b.Center+b.Motive
+	})
+	return append(events, booking...)
+}
+
+// EventStream fans out events to the connected /events clients as server-sent events.
+type EventStream struct {
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+	done    chan struct{}
+	close   sync.Once
+}
+
+var stream = &EventStream{clients: map[chan []byte]bool{}, done: make(chan struct{})}
+
+// Close disconnects all clients, so the server can shut down.
+func (s *EventStream) Close() {
+	s.close.Do(func() { close(s.done) })
+}
+
+// Publish sends the events to all clients. Events are dropped for clients not keeping up.
+func (s *EventStream) Publish(events []StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	for _, e := range events {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			continue
+		}
+		msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", e.Kind, data))
+		for c := range s.clients {
+			select {
+			case c <- msg:
+			default:
+			}
+		}
+	}
+}
+
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan []byte, 64)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// comments keep proxies from closing idle connections
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case msg := <-c:
+			w.Write(msg)
+		case <-keepalive.C:
+			w.Write([]byte(": keepalive\n\n"))
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/databus23/impfe/pkg/doctolib"
+)
+
+// Source provides vaccination centers and their availabilities.
+type Source interface {
+	Impfzentren(ctx context.Context, bookingPage string) ([]doctolib.Impfzentrum, error)
+	GetAvailabilities(ctx context.Context, practice int, motive int, agendaIDs []int) (*doctolib.AvailbilitiesResponse, error)
+	Search(ctx context.Context, speciality, place string, page int) (*doctolib.SearchResponse, error)
+}
+
+// doctolibSource fetches the data from Doctolib.
+type doctolibSource struct {
+	client *doctolib.Client
+	// limiter shared by all requests, unlimited if nil
+	limiter *TokenBucket
+}
+
+func (s doctolibSource) Impfzentren(ctx context.Context, bookingPage string) ([]doctolib.Impfzentrum, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.client.Impfzentren(ctx, bookingPage)
+}
+func (s doctolibSource) Search(ctx context.Context, speciality, place string, page int) (*doctolib.SearchResponse, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.client.Search(ctx, speciality, place, page)
+}
+func (s doctolibSource) GetAvailabilities(ctx context.Context, practice int, motive int, agendaIDs []int) (*doctolib.AvailbilitiesResponse, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	client := *s.client
+	client.Limit = Lookahead(ctx, centerLookahead(ctx, client.Limit))
+	client.InsuranceSector = InsuranceSector(ctx)
+	return client.GetAvailabilities(ctx, practice, motive, agendaIDs, clock.Now().In(location))
+}
+
+var source Source = doctolibSource{client: doctolib.NewClient(http.DefaultClient)}
+
+var syntheticMotives = map[int]string{
+	2495719: "Erstimpfung Covid-19 (BioNTech-Pfizer)",
+	2597576: "Zweitimpfung Covid-19 (BioNTech-Pfizer)",
+	2537716: "Erstimpfung Covid-19 (Moderna)",
+	2836586: "Erstimpfung Covid-19 (AstraZeneca)",
+}
+
+var syntheticCenters = []struct {
+	name     string
+	disabled []int
+}{
+	{"Arena Berlin", nil},
+	{"Erika-Hess-Eisstadion", []int{2836586}},
+	{"Flughafen Tegel", nil},
+	{"Messe Berlin", []int{2537716}},
+	{"Velodrom Berlin", []int{2495719, 2836586}},
+	{"Flughafen Tempelhof", nil},
+}
+
+// SyntheticSource generates plausible fake centers and availabilities which fluctuate
+// over time, so dashboards and alerts can be built without calling Doctolib.
+type SyntheticSource struct {
+	mu    sync.Mutex
+	pages []string
+	// next slot in days from today, negative if nothing is bookable
+	nextSlot map[practiceKey]int
+}
+
+func NewSyntheticSource() *SyntheticSource {
+	return &SyntheticSource{nextSlot: map[practiceKey]int{}}
+}
+
+func (s *SyntheticSource) Impfzentren(ctx context.Context, bookingPage string) ([]doctolib.Impfzentrum, error) {
+	s.mu.Lock()
+	page := len(s.pages)
+	for i, p := range s.pages {
+		if p == bookingPage {
+			page = i
+		}
+	}
+	if page == len(s.pages) {
+		s.pages = append(s.pages, bookingPage)
+	}
+	s.mu.Unlock()
+
+	openingHours := make([]doctolib.OpeningHours, 0, 6)
+	for day := 1; day <= 6; day++ {
+		openingHours = append(openingHours, doctolib.OpeningHours{Day: day, Enabled: true, Ranges: [][2]string{{"08:00", "20:00"}}})
+	}
+	centers := make([]doctolib.Impfzentrum, 0, len(syntheticCenters))
+	for i, c := range syntheticCenters {
+		center := doctolib.Impfzentrum{
+			ID:                  158431 + 1000*page + i,
+			Name:                c.name,
+			BookingPage:         bookingPage,
+			Vaccination:         map[int]string{},
+			DisabledVaccination: map[int]string{},
+			AgendaIDs:           []int{397766 + 1000*page + 10*i, 397767 + 1000*page + 10*i},
+			OpeningHours:        openingHours,
+			Zipcode:             fmt.Sprintf("1%d%03d", page%10, 100*i+50),
+			City:                "Berlin",
+		}
+		for id, name := range syntheticMotives {
+			center.Vaccination[id] = name
+		}
+		for _, id := range c.disabled {
+			center.DisabledVaccination[id] = center.Vaccination[id]
+			delete(center.Vaccination, id)
+		}
+		if page > 0 {
+			center.Name = fmt.Sprintf("%s (%s)", c.name, bookingPage)
+		}
+		centers = append(centers, center)
+	}
+	return centers, nil
+}
+
+func (s *SyntheticSource) GetAvailabilities(ctx context.Context, practice int, motive int, agendaIDs []int) (*doctolib.AvailbilitiesResponse, error) {
+	s.mu.Lock()
+	key := practiceKey{practice, motive, InsuranceSector(ctx)}
+	next, ok := s.nextSlot[key]
+	if !ok {
+		next = rand.Intn(40) - 5
+	}
+	// random walk, slots mostly drift away and occasionally get released in bulk
+	switch r := rand.Float64(); {
+	case r < 0.05:
+		next = rand.Intn(3)
+	case r < 0.1:
+		next = -1
+	case r < 0.5:
+		next++
+	}
+	if next > 60 {
+		next = 60
+	}
+	s.nextSlot[key] = next
+	s.mu.Unlock()
+
+	limit := Lookahead(ctx, centerLookahead(ctx, *lookahead))
+	today := Day(clock.Now())
+	resp := &doctolib.AvailbilitiesResponse{}
+	for i := 0; i < limit; i++ {
+		date := today.AddDate(0, 0, i)
+		a := doctolib.Availability{Date: date.Format("2006-01-02")}
+		if next >= 0 && i >= next {
+			for n := rand.Intn(8); n >= 0; n-- {
+				start := date.Add(8*time.Hour + time.Duration(rand.Intn(48))*15*time.Minute)
+				a.Slots = append(a.Slots, doctolib.Slot{Start: start.Format(time.RFC3339), End: start.Add(15 * time.Minute).Format(time.RFC3339), AgendaID: agendaIDs[0]})
+				resp.Total++
+			}
+		}
+		resp.Availabilities = append(resp.Availabilities, a)
+	}
+	resp.NumberOfFutureVacinations = 200 + rand.Intn(800)
+	if next >= limit {
+		resp.NextSlot = today.AddDate(0, 0, next).Format("2006-01-02")
+	}
+	return resp, nil
+}
+
+// Search returns two result pages with three synthetic booking pages each.
+func (s *SyntheticSource) Search(ctx context.Context, speciality, place string, page int) (*doctolib.SearchResponse, error) {
+	r := &doctolib.SearchResponse{}
+	r.Data.Total = 6
+	if page > 2 {
+		return r, nil
+	}
+	for i := 0; i < 3; i++ {
+		n := 3*(page-1) + i + 1
+		r.Data.Doctors = append(r.Data.Doctors, doctolib.SearchResult{
+			ID:      900000 + n,
+			Name:    fmt.Sprintf("Impfzentrum %s %d", strings.Title(place), n),
+			Link:    fmt.Sprintf("/%s/%s/synthetic-%s-%d", speciality, place, place, n),
+			Zipcode: fmt.Sprintf("1%04d", 100*n),
+			City:    strings.Title(place),
+		})
+	}
+	return r, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Tail polls every interval until ctx is done and writes each availability event to w in the given format (jsonl or text).
+func Tail(ctx context.Context, w io.Writer, format string, interval time.Duration) error {
+	if format != "jsonl" && format != "text" {
+		return fmt.Errorf("Unknown format %q", format)
+	}
+	if err := CheckRequestRate(ctx, interval); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	var prev *Snapshot
+	schedule := &CenterSchedule{Interval: interval}
+	for {
+		snap, err := Poll(NewCycle(schedule.Context(ctx)))
+		if err == nil {
+			schedule.Complete(prev, snap)
+		}
+		switch {
+		case err != nil:
+			log.Println("Error fetching impfzentren", err)
+		case !Unchanged(prev, snap):
+			for _, e := range Events(prev, snap) {
+				if format == "jsonl" {
+					if err := enc.Encode(e); err != nil {
+						return err
+					}
+					continue
+				}
+				next := "-"
+				if t, err := time.ParseInLocation("2006-01-02", e.NextSlot, location); err == nil {
+					next = FormatDate(t)
+				}
+				fmt.Fprintf(w, "%s  %s  %s  next=%s slots=%d\n", e.Time.In(location).Format(time.RFC3339), e.Center, e.Motive, next, e.Slots)
+			}
+			prev = snap
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(schedule.Tick()):
+		}
+	}
+}
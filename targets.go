@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RunTargets prints the monitoring plan resolved from the booking page.
+func RunTargets(ctx context.Context) error {
+	centers, err := Plan(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(centers, func(i, j int) bool {
+		if centers[i].BookingPage != centers[j].BookingPage {
+			return centers[i].BookingPage < centers[j].BookingPage
+		}
+		return centers[i].Name < centers[j].Name
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PAGE\tCENTER\tPRACTICE\tMOTIVE\tNAME\tCHANNEL\tAGENDAS\tSTATE")
+	motives := 0
+	for _, c := range centers {
+		agendas := make([]string, 0, len(c.AgendaIDs))
+		for _, id := range c.AgendaIDs {
+			agendas = append(agendas, fmt.Sprint(id))
+		}
+		for _, id := range sortedMotiveIDs(c.Vaccination) {
+			practices := make([]string, 0, 1)
+			for _, p := range c.Practices(id) {
+				practices = append(practices, fmt.Sprint(p))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\tpolled\n", c.BookingPage, c.Name, strings.Join(practices, ","), id, c.Vaccination[id], c.Channel(id), strings.Join(agendas, ","))
+			motives++
+		}
+		for _, id := range sortedMotiveIDs(c.DisabledVaccination) {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\tdisabled\n", c.BookingPage, c.Name, c.ID, id, c.DisabledVaccination[id], c.Channel(id), strings.Join(agendas, ","))
+		}
+	}
+	w.Flush()
+
+	requests := PlannedRequests(centers)
+	fmt.Printf("\n%d booking pages, %d centers, %d polled motives, %d requests per poll\n", len(BookingPages()), len(centers), motives, requests)
+	fmt.Printf("~%.0f requests/hour at a poll interval of %s", PlannedRequestRate(centers, *pollInterval), *pollInterval)
+	if *maxRequestsPerHour > 0 {
+		fmt.Printf(" (ceiling %.0f)", *maxRequestsPerHour)
+	}
+	fmt.Println()
+	if motives > 1 {
+		fmt.Printf("request spacing adds ~%s to each poll\n", (*maxRequestSpacing / 2 * time.Duration(motives-1)).Round(time.Millisecond))
+	}
+	if *rateLimit > 0 && requests > *rateBurst {
+		fmt.Printf("rate limit of %g/s stretches each poll to at least %s\n", *rateLimit, time.Duration(float64(requests-*rateBurst)/(*rateLimit)*float64(time.Second)).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func sortedMotiveIDs(motives map[int]string) []int {
+	ids := make([]int, 0, len(motives))
+	for id := range motives {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
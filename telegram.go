@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TelegramConfig configures the Telegram notifier.
+type TelegramConfig struct {
+	// Token of the bot as issued by the BotFather.
+	Token  string `yaml:"token"`
+	ChatID string `yaml:"chat_id"`
+	// APIURL of the bot API, https://api.telegram.org if empty.
+	APIURL   string          `yaml:"api_url"`
+	Template MessageTemplate `yaml:"template"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Tokens of further bots posting to the same chat. The notifications are spread over all
+	// bots to share their API limits, see NotifierPool.
+	Tokens []string `yaml:"tokens"`
+}
+
+// TelegramNotifier sends notifications as messages of a Telegram bot.
+type TelegramNotifier struct {
+	config TelegramConfig
+	format messageFormat
+	client *http.Client
+}
+
+// NewTelegramNotifier validates the config and returns the notifier.
+func NewTelegramNotifier(c TelegramConfig) (*TelegramNotifier, error) {
+	if c.Token == "" || c.ChatID == "" {
+		return nil, fmt.Errorf("Telegram notifier needs token and chat_id")
+	}
+	if c.APIURL == "" {
+		c.APIURL = "https://api.telegram.org"
+	}
+	format, err := newMessageFormat(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &TelegramNotifier{config: c, format: format, client: notifierHTTPClient("telegram")}, nil
+}
+
+func (t *TelegramNotifier) Name() string { return "telegram" }
+
+// DryRun verifies the token by fetching the bot.
+func (t *TelegramNotifier) DryRun(ctx context.Context) error {
+	return t.call(ctx, "getMe", map[string]interface{}{})
+}
+
+func (t *TelegramNotifier) Notify(ctx context.Context, n Notification) error {
+	return t.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id": t.config.ChatID,
+		"text":    t.format.Text(n),
+	})
+}
+
+func (t *TelegramNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return t.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id": t.config.ChatID,
+		"text":    title + "\n\n" + text,
+	})
+}
+
+// call invokes a method of the bot API.
+func (t *TelegramNotifier) call(ctx context.Context, method string, params map[string]interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.APIURL+"/bot"+t.config.Token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// the URL contains the token
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = strings.ReplaceAll(ue.URL, t.config.Token, "<token>")
+		}
+		return fmt.Errorf("Calling Telegram %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(msg)}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageTemplate customizes the title and text of notifications with Go templates.
+// Empty templates fall back to the template of the notify section and then to the built-in texts.
+type MessageTemplate struct {
+	Title string `yaml:"title"`
+	Text  string `yaml:"text"`
+}
+
+// MessageData is the data templates are executed with. Besides the fields it offers
+// the built-in texts as .Title and .Text and the raw event as .Event. Combined messages
+// carry the fields of the first alert and list all of them in .Group.
+type MessageData struct {
+	Notification
+	Center  string
+	Vaccine string
+	Motive  string
+	Dose    string
+	// NextSlot is the date of the next slot, zero if there is none.
+	NextSlot time.Time
+	Slots    int
+}
+
+// NewMessageData returns the template data of a notification.
+func NewMessageData(n Notification) MessageData {
+	d := MessageData{Notification: n, Center: n.Event.Center, Vaccine: n.Event.Vaccine, Motive: n.Event.Motive, Dose: n.Event.Dose, Slots: n.Event.Slots}
+	if t, err := ParseSlotTime(n.Event.NextSlot); err == nil {
+		d.NextSlot = t
+	}
+	return d
+}
+
+// templateFuncs are available in all message templates.
+var templateFuncs = template.FuncMap{
+	// date formats a date according to the locale, - if it is zero
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return FormatDate(t)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// messageFormat renders notifications, the built-in texts are used for nil templates.
+type messageFormat struct {
+	title, text *template.Template
+}
+
+// newMessageFormat compiles the template of a notifier.
+func newMessageFormat(t MessageTemplate) (messageFormat, error) {
+	var f messageFormat
+	var err error
+	if f.title, err = parseMessageTemplate("title", t.Title, config.Notify.Template.Title); err != nil {
+		return f, err
+	}
+	if f.text, err = parseMessageTemplate("text", t.Text, config.Notify.Template.Text); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func parseMessageTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s template: %s", name, err)
+	}
+	// catch references to unknown fields before the first notification
+	if err := t.Execute(io.Discard, NewMessageData(Notification{})); err != nil {
+		return nil, fmt.Errorf("Invalid %s template: %s", name, err)
+	}
+	return t, nil
+}
+
+// custom reports whether a template is configured.
+func (f messageFormat) custom() bool {
+	return f.title != nil || f.text != nil
+}
+
+// Title renders the title of a notification.
+func (f messageFormat) Title(n Notification) string {
+	return render(f.title, n, n.Title())
+}
+
+// Text renders the text of a notification.
+func (f messageFormat) Text(n Notification) string {
+	return render(f.text, n, n.Text())
+}
+
+// render executes t, falling back to the built-in text if there is no template or it fails.
+func render(t *template.Template, n Notification, builtin string) string {
+	if t == nil {
+		return builtin
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, NewMessageData(n)); err != nil {
+		log.Printf("Failed to render %s template: %s", t.Name(), err)
+		return builtin
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+var tlsFingerprints = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"ios":     utls.HelloIOS_Auto,
+	"edge":    utls.HelloEdge_Auto,
+}
+
+var (
+	connectTimeout = flag.Duration("http-connect-timeout", 10*time.Second, "Timeout for connecting to upstream including the TLS handshake")
+	readTimeout    = flag.Duration("http-read-timeout", 30*time.Second, "Timeout for reading an upstream response after the request was sent")
+)
+
+// RequestTimeout is the overall timeout of an upstream request.
+func RequestTimeout() time.Duration {
+	return *connectTimeout + *readTimeout
+}
+
+// NewDialer returns a dialer using the connect timeout, bound to localAddr if given.
+func NewDialer(localAddr net.IP) *net.Dialer {
+	dialer := &net.Dialer{Timeout: *connectTimeout, KeepAlive: 30 * time.Second}
+	if localAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localAddr}
+	}
+	return dialer
+}
+
+// NewTransport returns a transport using dialer and proxy (if not nil). If a fingerprint is given
+// the TLS handshakes mimic the ClientHello of that browser. Requests through a proxy are tunneled
+// by the transport itself and therefore keep the Go TLS fingerprint.
+func NewTransport(fingerprint string, dialer *net.Dialer, proxy *url.URL) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = *connectTimeout
+	transport.ResponseHeaderTimeout = *readTimeout
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if fingerprint == "" {
+		return transport, nil
+	}
+
+	id, ok := tlsFingerprints[strings.ToLower(fingerprint)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown TLS fingerprint %q", fingerprint)
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		uconn := utls.UClient(conn, &utls.Config{ServerName: host}, id)
+		if err := uconn.BuildHandshakeState(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// Browsers offer h2 but the transport can only speak HTTP/1.1 over a non crypto/tls connection.
+		for _, ext := range uconn.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+		if err := uconn.BuildHandshakeState(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		handshakeCtx, cancel := context.WithTimeout(ctx, *connectTimeout)
+		defer cancel()
+		if err := uconn.HandshakeContext(handshakeCtx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %s failed: %w", addr, err)
+		}
+		return uconn, nil
+	}
+	return transport, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// observingTransport logs upstream requests, records them in the request log,
+// feeds the error budget and dumps sampled response bodies.
+type observingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log.Println("Calling", req.URL)
+	record := RequestRecord{Time: clock.Now(), URL: req.URL.String()}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		record.Latency = clock.Now().Sub(record.Time)
+		record.ErrorClass = ErrorClass(0, err)
+		requestLog.Add(record)
+		return nil, err
+	}
+	errorBudget.Record(IsBlocked(resp.StatusCode))
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	record.Latency = clock.Now().Sub(record.Time)
+	record.Status = resp.StatusCode
+	record.Bytes = len(body)
+	record.ErrorClass = ErrorClass(resp.StatusCode, err)
+	requestLog.Add(record)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if practice, err := strconv.Atoi(req.URL.Query().Get("practice_ids")); err == nil && resp.StatusCode < 400 {
+		payloads.Dump(practice, req.URL.String(), body)
+	}
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+//go:embed vaccines.json
+var vaccinesJSON []byte
+
+// Vaccine holds the metadata of a vaccine product.
+type Vaccine struct {
+	ID              string   `json:"id"`
+	Product         string   `json:"product"`
+	Platform        string   `json:"platform"`
+	Doses           int      `json:"doses"`
+	MinIntervalDays int      `json:"min_interval_days"`
+	Match           []string `json:"match"`
+}
+
+var vaccines = loadVaccines()
+
+func loadVaccines() []Vaccine {
+	var v []Vaccine
+	if err := json.Unmarshal(vaccinesJSON, &v); err != nil {
+		log.Fatalf("Failed to parse built-in vaccines: %s", err)
+	}
+	return v
+}
+
+// foldMotive lowercases a motive name and replaces umlauts for matching.
+var foldMotive = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "Ä", "ae", "Ö", "oe", "Ü", "ue")
+
+// VaccineForMotive returns the vaccine a motive name refers to.
+func VaccineForMotive(motive string) (Vaccine, bool) {
+	name := foldMotive.Replace(strings.ToLower(motive))
+	for _, v := range vaccines {
+		for _, m := range v.Match {
+			if strings.Contains(name, m) {
+				return v, true
+			}
+		}
+	}
+	return Vaccine{}, false
+}
+
+// unknownLabel is the value of normalized labels which could not be determined.
+const unknownLabel = "unknown"
+
+// VaccineLabel returns the canonical vaccine of a motive, e.g. biontech.
+func VaccineLabel(motive string) string {
+	if v, ok := VaccineForMotive(motive); ok {
+		return v.ID
+	}
+	return unknownLabel
+}
+
+// doseMatches map words of motive names to the dose, checked in order.
+var doseMatches = []struct {
+	dose  string
+	match []string
+}{
+	{"booster", []string{"auffrisch", "booster", "dritt", "3. impfung", "viert", "4. impfung"}},
+	{"second", []string{"zweit", "2. impfung", "second"}},
+	{"first", []string{"erst", "1. impfung", "first", "einzel"}},
+}
+
+// DoseLabel returns the dose of a motive: first, second, booster or unknown.
+func DoseLabel(motive string) string {
+	name := foldMotive.Replace(strings.ToLower(motive))
+	for _, d := range doseMatches {
+		for _, m := range d.match {
+			if strings.Contains(name, m) {
+				return d.dose
+			}
+		}
+	}
+	return unknownLabel
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// ANSI colors of the watch table, all of the same length to keep the columns aligned.
+const (
+	colorBold     = "\033[01m"
+	colorFree     = "\033[32m"
+	colorNone     = "\033[90m"
+	colorDisabled = "\033[33m"
+	colorReset    = "\033[0m"
+)
+
+// Watch polls every interval until ctx is done and redraws a table of all vaccination types,
+// free ones first. On a terminal the screen is cleared before each redraw and the rows are
+// colored unless NO_COLOR is set.
+func Watch(ctx context.Context, w io.Writer, interval time.Duration) error {
+	if err := CheckRequestRate(ctx, interval); err != nil {
+		return err
+	}
+	terminal := isTerminal(w)
+	if terminal {
+		// log lines would scroll the table away, errors are shown below it
+		log.SetOutput(io.Discard)
+	}
+	color := terminal && os.Getenv("NO_COLOR") == ""
+	var snap *Snapshot
+	schedule := &CenterSchedule{Interval: interval}
+	for {
+		s, err := Poll(NewCycle(schedule.Context(ctx)))
+		if err == nil {
+			schedule.Complete(snap, s)
+			snap = s
+		}
+		if terminal {
+			fmt.Fprint(w, "\033[H\033[2J")
+		}
+		renderWatch(w, snap, color)
+		status := fmt.Sprintf("Stand %s, naechste Abfrage in %s", clock.Now().In(location).Format("15:04:05"), schedule.Tick())
+		if err != nil {
+			status += ", Abfrage fehlgeschlagen: " + err.Error()
+		}
+		fmt.Fprintln(w, "\n"+status)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(schedule.Tick()):
+		}
+	}
+}
+
+// renderWatch writes the table of a snapshot, which may be nil before the first successful poll.
+func renderWatch(w io.Writer, snap *Snapshot, color bool) {
+	if snap == nil {
+		fmt.Fprintln(w, "Noch keine Daten")
+		return
+	}
+	paint := func(c string) string {
+		if !color {
+			return ""
+		}
+		return c
+	}
+	reset := paint(colorReset)
+	sectors := len(InsuranceSectors()) > 1
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "CENTER\tMOTIVE\tNEXT\tSLOTS"
+	if sectors {
+		header += "\tINSURANCE"
+	}
+	fmt.Fprintln(tw, paint(colorBold)+header+reset)
+
+	row := func(c string, o Observation, next, slots string) {
+		line := fmt.Sprintf("%s%s\t%s\t%s\t%s", paint(c), o.Center.Name, o.Motive, next, slots)
+		if sectors {
+			line += "\t" + o.Insurance
+		}
+		fmt.Fprintln(tw, line+reset)
+	}
+	free := available(snap)
+	for _, o := range free {
+		row(colorFree, o, FormatDate(o.NextSlot), fmt.Sprint(o.Slots))
+	}
+	var none []Observation
+	for _, o := range snap.Observations {
+		if o.Slots == 0 {
+			none = append(none, o)
+		}
+	}
+	sort.Slice(none, func(i, j int) bool {
+		return none[i].Center.Name+none[i].Motive+none[i].Insurance < none[j].Center.Name+none[j].Motive+none[j].Insurance
+	})
+	for _, o := range none {
+		next := "-"
+		if !o.NextSlot.IsZero() {
+			next = FormatDate(o.NextSlot)
+		}
+		row(colorNone, o, next, "0")
+	}
+	var disabled []Observation
+	for _, c := range snap.Centers {
+		for id, motive := range c.DisabledVaccination {
+			disabled = append(disabled, Observation{Center: c, MotiveID: id, Motive: motive})
+		}
+	}
+	sort.Slice(disabled, func(i, j int) bool {
+		return disabled[i].Center.Name+disabled[i].Motive < disabled[j].Center.Name+disabled[j].Motive
+	})
+	for _, o := range disabled {
+		row(colorDisabled, o, "deaktiviert", "-")
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d von %d Impfungen mit freien Terminen\n", len(free), len(free)+len(none))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookConfig configures a webhook receiving every availability change.
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+	// Profile names the notifier for impfe notify-test --profile.
+	Profile string `yaml:"profile"`
+	// Pool spreads the notifications over the notifiers of the backend with the same pool, see NotifierPool.
+	Pool string `yaml:"pool"`
+	// BatchWindow collects the changes for this long after the first and posts them as a
+	// JSON array, 0 posts every change on its own.
+	BatchWindow time.Duration `yaml:"batch_window"`
+}
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	AvailabilityEvent
+	Link     string `json:"link"`
+	NewSlots bool   `json:"new_slots"`
+	Alert    bool   `json:"alert"`
+	// Confidence is confirmed or listed if the slot was fetched again.
+	Confidence string           `json:"confidence,omitempty"`
+	Previous   *WebhookPrevious `json:"previous,omitempty"`
+	Diff       *WebhookDiff     `json:"diff,omitempty"`
+}
+
+// WebhookPrevious is the availability of the previous poll.
+type WebhookPrevious struct {
+	NextSlot string `json:"next_slot,omitempty"`
+	Slots    int    `json:"slots"`
+}
+
+// WebhookDiff is the change against the previous poll.
+type WebhookDiff struct {
+	Slots int `json:"slots"`
+	// NextSlotDays is the shift of the next slot in days, nil if there was no next slot before or after.
+	NextSlotDays *int `json:"next_slot_days,omitempty"`
+}
+
+// WebhookBroadcast is the payload of an operator broadcast, told apart from
+// availability changes by the broadcast key.
+type WebhookBroadcast struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Broadcast     WebhookAnnouncement `json:"broadcast"`
+}
+
+// WebhookAnnouncement is an operator message, e.g. about maintenance.
+type WebhookAnnouncement struct {
+	Time  time.Time `json:"time"`
+	Title string    `json:"title"`
+	Text  string    `json:"text"`
+}
+
+// NewWebhookPayload builds the payload of a notification.
+func NewWebhookPayload(n Notification) WebhookPayload {
+	p := WebhookPayload{AvailabilityEvent: n.Event, Link: n.Link, NewSlots: n.NewSlots, Alert: n.Alert, Confidence: n.Confidence}
+	if n.Previous != nil {
+		p.Previous = &WebhookPrevious{Slots: n.Previous.Slots}
+		p.Diff = &WebhookDiff{Slots: n.Event.Slots - n.Previous.Slots}
+		if !n.Previous.NextSlot.IsZero() {
+			p.Previous.NextSlot = n.Previous.NextSlot.Format("2006-01-02")
+			if next, err := ParseSlotTime(n.Event.NextSlot); err == nil {
+				days := int(next.Sub(n.Previous.NextSlot).Round(24*time.Hour) / (24 * time.Hour))
+				p.Diff.NextSlotDays = &days
+			}
+		}
+	}
+	return p
+}
+
+// WebhookNotifier posts every availability change as JSON to a URL.
+type WebhookNotifier struct {
+	config WebhookConfig
+	name   string
+	client *http.Client
+}
+
+// NewWebhookNotifier validates the config and returns the notifier.
+func NewWebhookNotifier(c WebhookConfig) (*WebhookNotifier, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Invalid webhook URL %q", c.URL)
+	}
+	if c.BatchWindow < 0 {
+		return nil, fmt.Errorf("Batch window of webhook %s must not be negative, got %s", u.Host, c.BatchWindow)
+	}
+	return &WebhookNotifier{config: c, name: "webhook/" + u.Host, client: notifierHTTPClient("webhook")}, nil
+}
+
+func (w *WebhookNotifier) Name() string { return w.name }
+
+func (w *WebhookNotifier) AllChanges() bool { return true }
+
+func (w *WebhookNotifier) BatchWindow() time.Duration { return w.config.BatchWindow }
+
+// Notify posts the payload of the notification, or an array of the payloads of a batch
+// if the webhook has a batch window.
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	if w.config.BatchWindow <= 0 {
+		return w.post(ctx, NewWebhookPayload(n))
+	}
+	members := n.Group
+	if len(members) == 0 {
+		members = []Notification{n}
+	}
+	batch := make([]WebhookPayload, len(members))
+	for i, m := range members {
+		batch[i] = NewWebhookPayload(m)
+	}
+	return w.post(ctx, batch)
+}
+
+func (w *WebhookNotifier) Broadcast(ctx context.Context, title, text string) error {
+	return w.post(ctx, WebhookBroadcast{SchemaVersion: EventSchemaVersion, Broadcast: WebhookAnnouncement{Time: clock.Now(), Title: title, Text: text}})
+}
+
+// post sends v as JSON to the URL.
+func (w *WebhookNotifier) post(ctx context.Context, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "impfe")
+	for k, v := range w.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(msg)}
+	}
+	return nil
+}